@@ -0,0 +1,328 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DEXPRO-Solutions-GmbH/go-dauth/http/authn"
+	"github.com/DEXPRO-Solutions-GmbH/go-dauth/http/authserver"
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix is the prefix of all environment variables read by this binary.
+const envPrefix = "DAUTH_"
+
+// config is the configuration of the auth server.
+//
+// Values are read in the following order, later sources overriding earlier ones: defaults, YAML file,
+// environment variables, command line flags.
+type config struct {
+	// ListenAddr is the address the HTTP server listens on.
+	ListenAddr string `yaml:"listen_addr"`
+	// TrustedIssuers are the base URLs of trusted Keycloak servers or realms.
+	TrustedIssuers []string `yaml:"trusted_issuers"`
+	// PrewarmIssuers are realm issuers whose keys are fetched before the server reports to be ready.
+	PrewarmIssuers []string `yaml:"prewarm_issuers"`
+	// CookieName is the name of the cookie carrying access tokens.
+	CookieName string `yaml:"cookie_name"`
+	// Audiences restricts accepted tokens to the given audiences. Empty accepts all audiences.
+	Audiences []string `yaml:"audiences"`
+	// HeaderMode is the encoding of the claims header: "json", "base64" or "base64-gzip".
+	HeaderMode string `yaml:"header_mode"`
+	// HeaderPrefix is the prefix of all headers set by the server.
+	HeaderPrefix string `yaml:"header_prefix"`
+	// ClaimHeaders enables flat claim headers in addition to the JSON claims header.
+	ClaimHeaders bool `yaml:"claim_headers"`
+	// HeaderSigningKeyId is the id of the key headers are signed with. It must be contained in HeaderSigningKeys.
+	HeaderSigningKeyId string `yaml:"header_signing_key_id"`
+	// HeaderSigningKeys are the base64 encoded HMAC keys shared with upstream services, mapped by key id. Keep the
+	// previous key during rotations until all services verify with the new one.
+	HeaderSigningKeys map[string]string `yaml:"header_signing_keys"`
+	// UnsignedHeaders disables header signing. Only use this if upstream services cannot be reached without passing
+	// a proxy which removes the headers of this server from client requests.
+	UnsignedHeaders bool `yaml:"unsigned_headers"`
+	// ForwardToken enables forwarding of the original access token to upstream services.
+	ForwardToken bool `yaml:"forward_token"`
+	// LoginURL is the login endpoint browsers without a valid token are redirected to. Empty disables redirects
+	// unless LoginURLs are set.
+	LoginURL string `yaml:"login_url"`
+	// LoginURLs are login endpoints mapped by the host of the original request, e.g. one per realm. Hosts not
+	// contained are redirected to LoginURL.
+	LoginURLs map[string]string `yaml:"login_urls"`
+	// LoginAllowedHosts are the hosts redirected to the login in addition to the host of LoginURL.
+	LoginAllowedHosts []string `yaml:"login_allowed_hosts"`
+	// TokenCacheSize is the maximum number of cached validated tokens. Zero disables the cache.
+	TokenCacheSize int `yaml:"token_cache_size"`
+	// TokenCacheTTL is the maximum duration a validated token is cached.
+	TokenCacheTTL time.Duration `yaml:"token_cache_ttl"`
+	// ShutdownTimeout is the time given to in-flight requests when shutting down.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+func defaultConfig() *config {
+	return &config{
+		ListenAddr:      ":8080",
+		CookieName:      "dexp-at",
+		HeaderMode:      "json",
+		HeaderPrefix:    "Dexp-Authserver-",
+		TokenCacheTTL:   5 * time.Minute,
+		ShutdownTimeout: 10 * time.Second,
+	}
+}
+
+// loadConfig loads the configuration from the given command line arguments and environment.
+func loadConfig(args []string, getenv func(string) string) (*config, error) {
+	cfg := defaultConfig()
+
+	fs := flag.NewFlagSet("dauth-authserver", flag.ContinueOnError)
+	configPath := fs.String("config", getenv(envPrefix+"CONFIG"), "path to a YAML configuration file")
+	fs.String("listen-addr", "", "address to listen on (default \""+cfg.ListenAddr+"\")")
+	fs.String("trusted-issuers", "", "comma separated base URLs of trusted issuers")
+	fs.String("prewarm-issuers", "", "comma separated issuers whose keys are fetched on startup")
+	fs.String("cookie-name", "", "name of the access token cookie (default \""+cfg.CookieName+"\")")
+	fs.String("audiences", "", "comma separated list of accepted audiences")
+	fs.String("header-mode", "", "claims header encoding: json, base64 or base64-gzip (default \""+cfg.HeaderMode+"\")")
+	fs.String("header-prefix", "", "prefix of all headers set by the server (default \""+cfg.HeaderPrefix+"\")")
+	fs.String("header-signing-key-id", "", "id of the key headers are signed with")
+	fs.String("header-signing-keys", "", "comma separated id=base64 HMAC keys shared with upstream services")
+	fs.Bool("unsigned-headers", false, "do not sign headers")
+	fs.Bool("claim-headers", false, "set flat claim headers")
+	fs.Bool("forward-token", false, "forward the access token to upstream services")
+	fs.String("login-url", "", "login endpoint to redirect browsers without a valid token to")
+	fs.String("login-urls", "", "comma separated host=url login endpoints")
+	fs.String("login-allowed-hosts", "", "comma separated hosts redirected to the login in addition to the host of the login url")
+	fs.String("token-cache-size", "", "maximum number of cached validated tokens, 0 disables the cache")
+	fs.String("token-cache-ttl", "", "maximum duration a validated token is cached (default "+cfg.TokenCacheTTL.String()+")")
+	fs.String("shutdown-timeout", "", "time given to in-flight requests on shutdown (default "+cfg.ShutdownTimeout.String()+")")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *configPath != "" {
+		if err := cfg.loadFile(*configPath); err != nil {
+			return nil, err
+		}
+	}
+
+	// Environment variables, e.g. DAUTH_LISTEN_ADDR for the flag "listen-addr"
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == "config" || err != nil {
+			return
+		}
+		if value := getenv(envPrefix + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))); value != "" {
+			err = cfg.set(f.Name, value)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Explicitly set flags
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "config" || err != nil {
+			return
+		}
+		err = cfg.set(f.Name, f.Value.String())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func (cfg *config) loadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening config file failed: %w", err)
+	}
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil {
+		return fmt.Errorf("parsing config file failed: %w", err)
+	}
+	return nil
+}
+
+// set sets the value of the option with the given flag name.
+func (cfg *config) set(name string, value string) error {
+	var err error
+	switch name {
+	case "listen-addr":
+		cfg.ListenAddr = value
+	case "trusted-issuers":
+		cfg.TrustedIssuers = splitList(value)
+	case "prewarm-issuers":
+		cfg.PrewarmIssuers = splitList(value)
+	case "cookie-name":
+		cfg.CookieName = value
+	case "audiences":
+		cfg.Audiences = splitList(value)
+	case "header-mode":
+		cfg.HeaderMode = value
+	case "header-prefix":
+		cfg.HeaderPrefix = value
+	case "header-signing-key-id":
+		cfg.HeaderSigningKeyId = value
+	case "header-signing-keys":
+		cfg.HeaderSigningKeys, err = parseKeyList(value)
+	case "unsigned-headers":
+		cfg.UnsignedHeaders, err = strconv.ParseBool(value)
+	case "claim-headers":
+		cfg.ClaimHeaders, err = strconv.ParseBool(value)
+	case "forward-token":
+		cfg.ForwardToken, err = strconv.ParseBool(value)
+	case "login-url":
+		cfg.LoginURL = value
+	case "login-urls":
+		cfg.LoginURLs, err = parseKeyList(value)
+	case "login-allowed-hosts":
+		cfg.LoginAllowedHosts = splitList(value)
+	case "token-cache-size":
+		cfg.TokenCacheSize, err = strconv.Atoi(value)
+	case "token-cache-ttl":
+		cfg.TokenCacheTTL, err = time.ParseDuration(value)
+	case "shutdown-timeout":
+		cfg.ShutdownTimeout, err = time.ParseDuration(value)
+	default:
+		return fmt.Errorf("unknown option '%s'", name)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid value for option '%s': %w", name, err)
+	}
+	return nil
+}
+
+func (cfg *config) validate() error {
+	if len(cfg.TrustedIssuers) == 0 {
+		return errors.New("at least one trusted issuer is required")
+	}
+	for _, baseUrl := range cfg.TrustedIssuers {
+		if err := authn.ValidateIssuerBaseUrl(baseUrl); err != nil {
+			return fmt.Errorf("invalid trusted issuer: %w", err)
+		}
+	}
+	for _, issuer := range cfg.PrewarmIssuers {
+		if !authn.IsTrustedIssuer(issuer, cfg.TrustedIssuers) {
+			return fmt.Errorf("issuer '%s' is not trusted", issuer)
+		}
+	}
+	if _, err := cfg.claimsEncoding(); err != nil {
+		return err
+	}
+	if !cfg.UnsignedHeaders {
+		if _, err := cfg.keyRing(); err != nil {
+			return err
+		}
+	}
+	for _, loginURL := range cfg.loginURLs() {
+		if login, err := url.Parse(loginURL); err != nil || login.Scheme != "https" && login.Scheme != "http" || login.Host == "" {
+			return fmt.Errorf("invalid login url '%s'", loginURL)
+		}
+	}
+	return nil
+}
+
+// loginURLs returns all configured login endpoints.
+func (cfg *config) loginURLs() []string {
+	var loginURLs []string
+	if cfg.LoginURL != "" {
+		loginURLs = append(loginURLs, cfg.LoginURL)
+	}
+	for _, loginURL := range cfg.LoginURLs {
+		loginURLs = append(loginURLs, loginURL)
+	}
+	return loginURLs
+}
+
+// loginURLResolver returns the resolver of the configured login endpoints, or nil if login redirects are disabled.
+func (cfg *config) loginURLResolver() authserver.LoginURLResolver {
+	if len(cfg.LoginURLs) == 0 {
+		if cfg.LoginURL == "" {
+			return nil
+		}
+		return authserver.StaticLoginURL(cfg.LoginURL)
+	}
+
+	hosts := authserver.HostLoginURLs(cfg.LoginURLs)
+	return func(original *url.URL) (string, bool) {
+		if loginURL, ok := hosts(original); ok {
+			return loginURL, true
+		}
+		return cfg.LoginURL, cfg.LoginURL != ""
+	}
+}
+
+func (cfg *config) claimsEncoding() (authserver.ClaimsEncoding, error) {
+	switch cfg.HeaderMode {
+	case "json":
+		return authserver.ClaimsEncodingJSON, nil
+	case "base64":
+		return authserver.ClaimsEncodingBase64, nil
+	case "base64-gzip":
+		return authserver.ClaimsEncodingBase64Gzip, nil
+	default:
+		return 0, fmt.Errorf("invalid header mode '%s'", cfg.HeaderMode)
+	}
+}
+
+// minSigningKeySize is the minimum size of header signing keys in bytes.
+const minSigningKeySize = 32
+
+// keyRing returns the key ring of the configured header signing keys.
+func (cfg *config) keyRing() (*authserver.KeyRing, error) {
+	if cfg.HeaderSigningKeyId == "" || len(cfg.HeaderSigningKeys) == 0 {
+		return nil, errors.New("header signing requires a signing key id and keys, set unsigned_headers to disable signing")
+	}
+
+	keys := map[string][]byte{}
+	for id, encoded := range cfg.HeaderSigningKeys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid header signing key '%s': %w", id, err)
+		}
+		if len(key) < minSigningKeySize {
+			return nil, fmt.Errorf("header signing key '%s' must have at least %d bytes", id, minSigningKeySize)
+		}
+		keys[id] = key
+	}
+
+	return authserver.NewKeyRing(cfg.HeaderSigningKeyId, keys)
+}
+
+// parseKeyList parses a comma separated list of id=value pairs.
+func parseKeyList(value string) (map[string]string, error) {
+	keys := map[string]string{}
+	for _, item := range splitList(value) {
+		id, key, found := strings.Cut(item, "=")
+		if !found || id == "" {
+			return nil, fmt.Errorf("invalid key '%s', expected id=value", id)
+		}
+		keys[id] = key
+	}
+	return keys, nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfig(t *testing.T) {
+	// env returns the given environment with a valid header signing key
+	env := func(values map[string]string) func(string) string {
+		return func(key string) string {
+			if value, ok := values[key]; ok {
+				return value
+			}
+			return testSigningEnv[key]
+		}
+	}
+
+	t.Run("requires trusted issuers", func(t *testing.T) {
+		_, err := loadConfig(nil, env(nil))
+		assert.Error(t, err)
+	})
+
+	t.Run("uses defaults", func(t *testing.T) {
+		cfg, err := loadConfig([]string{"-trusted-issuers", "https://auth.dexpro.de/realms/"}, env(nil))
+		require.NoError(t, err)
+		assert.Equal(t, ":8080", cfg.ListenAddr)
+		assert.Equal(t, "json", cfg.HeaderMode)
+		assert.Equal(t, []string{"https://auth.dexpro.de/realms/"}, cfg.TrustedIssuers)
+	})
+
+	t.Run("flags override environment override file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		require.NoError(t, os.WriteFile(path, []byte(`
+listen_addr: ":9000"
+trusted_issuers:
+  - https://auth.dexpro.de/realms/
+audiences: [api]
+cookie_name: file-cookie
+header_mode: base64
+claim_headers: true
+shutdown_timeout: 3s
+token_cache_size: 100
+`), 0o600))
+
+		cfg, err := loadConfig([]string{"-cookie-name", "flag-cookie"}, env(map[string]string{
+			"DAUTH_CONFIG":          path,
+			"DAUTH_LISTEN_ADDR":     ":9001",
+			"DAUTH_COOKIE_NAME":     "env-cookie",
+			"DAUTH_AUDIENCES":       "api, web",
+			"DAUTH_TOKEN_CACHE_TTL": "1m",
+		}))
+		require.NoError(t, err)
+		assert.Equal(t, ":9001", cfg.ListenAddr)
+		assert.Equal(t, "flag-cookie", cfg.CookieName)
+		assert.Equal(t, []string{"api", "web"}, cfg.Audiences)
+		assert.Equal(t, "base64", cfg.HeaderMode)
+		assert.True(t, cfg.ClaimHeaders)
+		assert.Equal(t, 3*time.Second, cfg.ShutdownTimeout)
+		assert.Equal(t, 100, cfg.TokenCacheSize)
+		assert.Equal(t, time.Minute, cfg.TokenCacheTTL)
+	})
+
+	t.Run("requires header signing keys", func(t *testing.T) {
+		args := []string{"-trusted-issuers", "https://auth.dexpro.de/realms/"}
+
+		_, err := loadConfig(args, env(map[string]string{"DAUTH_HEADER_SIGNING_KEYS": ""}))
+		assert.Error(t, err)
+
+		_, err = loadConfig(args, env(map[string]string{"DAUTH_HEADER_SIGNING_KEYS": "k1=c2hvcnQ="}))
+		assert.Error(t, err, "keys must not be too short")
+
+		_, err = loadConfig(args, env(map[string]string{"DAUTH_HEADER_SIGNING_KEY_ID": "k2"}))
+		assert.Error(t, err, "signing key must be contained in keys")
+
+		cfg, err := loadConfig(append(args, "-unsigned-headers"), env(map[string]string{"DAUTH_HEADER_SIGNING_KEYS": ""}))
+		require.NoError(t, err)
+		assert.True(t, cfg.UnsignedHeaders)
+	})
+
+	t.Run("parses boolean flags", func(t *testing.T) {
+		cfg, err := loadConfig([]string{"-trusted-issuers", "https://auth.dexpro.de/realms/", "-claim-headers", "-forward-token=false"}, env(map[string]string{
+			"DAUTH_FORWARD_TOKEN": "true",
+		}))
+		require.NoError(t, err)
+		assert.True(t, cfg.ClaimHeaders)
+		assert.False(t, cfg.ForwardToken, "flags must override environment")
+	})
+
+	t.Run("rejects invalid issuers", func(t *testing.T) {
+		_, err := loadConfig([]string{"-trusted-issuers", "auth.dexpro.de"}, env(nil))
+		assert.Error(t, err)
+
+		_, err = loadConfig([]string{"-trusted-issuers", "https://auth.dexpro.de/realms/", "-prewarm-issuers", "https://auth.dexpro.de.evil.com/realms/x"}, env(nil))
+		assert.Error(t, err)
+	})
+
+	t.Run("rejects unknown file options", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		require.NoError(t, os.WriteFile(path, []byte("unknown: true\n"), 0o600))
+
+		_, err := loadConfig([]string{"-config", path, "-trusted-issuers", "https://auth.dexpro.de"}, env(nil))
+		assert.Error(t, err)
+	})
+
+	t.Run("resolves login urls by host", func(t *testing.T) {
+		cfg, err := loadConfig([]string{
+			"-trusted-issuers", "https://auth.dexpro.de",
+			"-login-url", "https://app.dexpro.de/auth/login",
+			"-login-urls", "acme.dexpro.de=https://acme.dexpro.de/auth/login",
+		}, env(nil))
+		require.NoError(t, err)
+
+		resolve := func(host string) string {
+			loginURL, ok := cfg.loginURLResolver()(&url.URL{Scheme: "https", Host: host})
+			require.True(t, ok)
+			return loginURL
+		}
+		assert.Equal(t, "https://acme.dexpro.de/auth/login", resolve("acme.dexpro.de"))
+		assert.Equal(t, "https://app.dexpro.de/auth/login", resolve("other.dexpro.de"))
+	})
+
+	t.Run("rejects invalid values", func(t *testing.T) {
+		_, err := loadConfig([]string{"-trusted-issuers", "https://auth.dexpro.de", "-header-mode", "xml"}, env(nil))
+		assert.Error(t, err)
+
+		_, err = loadConfig([]string{"-trusted-issuers", "https://auth.dexpro.de", "-login-url", "/auth/login"}, env(nil))
+		assert.Error(t, err)
+
+		_, err = loadConfig([]string{"-trusted-issuers", "https://auth.dexpro.de", "-login-urls", "acme.dexpro.de=/auth/login"}, env(nil))
+		assert.Error(t, err)
+
+		_, err = loadConfig([]string{"-trusted-issuers", "https://auth.dexpro.de"}, env(map[string]string{
+			"DAUTH_FORWARD_TOKEN": "maybe",
+		}))
+		assert.Error(t, err)
+	})
+}
+
+// testSigningKey is a valid base64 encoded header signing key.
+var testSigningKey = base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+
+// testSigningEnv configures testSigningKey as header signing key.
+var testSigningEnv = map[string]string{
+	"DAUTH_HEADER_SIGNING_KEY_ID": "k1",
+	"DAUTH_HEADER_SIGNING_KEYS":   "k1=" + testSigningKey,
+}
@@ -0,0 +1,177 @@
+// Command dauth-authserver runs an authserver.AuthServer as forward-auth endpoint for proxies like nginx
+// (auth_request) or Traefik (ForwardAuth).
+//
+// Besides the auth endpoint, the server provides the following endpoints:
+//   - /healthz responds with status 200 as long as the process is running
+//   - /readyz responds with status 200 once the keys of all prewarm issuers have been fetched
+//
+// See config for available options.
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/DEXPRO-Solutions-GmbH/go-dauth/http/authn"
+	"github.com/DEXPRO-Solutions-GmbH/go-dauth/http/authserver"
+)
+
+// prewarmRetryInterval is the interval between failed attempts to fetch the keys of prewarm issuers.
+const prewarmRetryInterval = 5 * time.Second
+
+func main() {
+	cfg, err := loadConfig(os.Args[1:], os.Getenv)
+	if err != nil {
+		log.Fatalf("loading configuration failed: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, cfg); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(ctx context.Context, cfg *config) error {
+	jwksManager := authn.NewJwksManager()
+	defer jwksManager.Close()
+
+	handler, err := newHandler(cfg, jwksManager)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{
+		Addr:              cfg.ListenAddr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go handler.prewarm(ctx, jwksManager, cfg.PrewarmIssuers)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("listening on %s", cfg.ListenAddr)
+		serveErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("shutting down")
+	handler.ready.Store(false)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// handler serves the auth endpoint and the health endpoints.
+type handler struct {
+	*http.ServeMux
+
+	ready atomic.Bool
+}
+
+func newHandler(cfg *config, jwksManager *authn.JwksManager) (*handler, error) {
+	encoding, err := cfg.claimsEncoding()
+	if err != nil {
+		return nil, err
+	}
+
+	extractor := authn.NewTokenExtractorChain().
+		Append(authn.NewBearerHeaderTokenExtractor()).
+		Append(authn.NewJwtCookieExtractor(cfg.CookieName, authn.NewBase64CookieEncoder()))
+	keyfunc := authn.NewKeycloakIssuersKeyfunc(cfg.TrustedIssuers, jwksManager)
+	stackOpts := []authn.AuthStackOption{authn.WithAudiences(cfg.Audiences...)}
+	if cfg.TokenCacheSize > 0 {
+		cache := authn.NewTokenCache(
+			authn.WithTokenCacheMaxSize(cfg.TokenCacheSize),
+			authn.WithTokenCacheMaxTTL(cfg.TokenCacheTTL),
+		)
+		cache.PurgeOnKeyChange(jwksManager)
+		stackOpts = append(stackOpts, authn.WithTokenCache(cache))
+	}
+	stack := authn.NewAuthStack(extractor, keyfunc, stackOpts...)
+
+	codec := authserver.NewHeaderCodec(
+		authserver.WithHeaderPrefix(cfg.HeaderPrefix),
+		authserver.WithClaimsEncoding(encoding),
+	)
+	opts := []authserver.AuthServerOption{authserver.WithHeaderCodec(codec)}
+	if !cfg.UnsignedHeaders {
+		keys, err := cfg.keyRing()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, authserver.WithHeaderSigner(authserver.NewHeaderSigner(keys, 0)))
+	}
+	if cfg.ClaimHeaders {
+		opts = append(opts, authserver.WithClaimHeaders(nil))
+	}
+	if cfg.ForwardToken {
+		opts = append(opts, authserver.WithTokenForwarding())
+	}
+	if resolver := cfg.loginURLResolver(); resolver != nil {
+		opts = append(opts, authserver.WithLoginRedirect(&authserver.LoginRedirect{
+			LoginURL:     resolver,
+			AllowedHosts: cfg.LoginAllowedHosts,
+		}))
+	}
+
+	h := &handler{ServeMux: http.NewServeMux()}
+	h.Handle("/", authserver.NewAuthServer(stack, opts...))
+	h.HandleFunc("/healthz", func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusOK)
+	})
+	h.HandleFunc("/readyz", func(writer http.ResponseWriter, request *http.Request) {
+		if !h.ready.Load() {
+			http.Error(writer, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		writer.WriteHeader(http.StatusOK)
+	})
+
+	return h, nil
+}
+
+// prewarm fetches the keys of the given issuers and marks the handler as ready afterwards. Failed attempts are
+// retried until the context is cancelled.
+func (h *handler) prewarm(ctx context.Context, jwksManager *authn.JwksManager, issuers []string) {
+	urls := make([]string, 0, len(issuers))
+	for _, issuer := range issuers {
+		urls = append(urls, authn.KeycloakJwksURL(issuer))
+	}
+
+	for {
+		err := jwksManager.Prewarm(urls...)
+		if err == nil {
+			h.ready.Store(true)
+			return
+		}
+		log.Printf("prewarming keys failed, retrying in %s: %v", prewarmRetryInterval, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(prewarmRetryInterval):
+		}
+	}
+}
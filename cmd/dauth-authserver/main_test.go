@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DEXPRO-Solutions-GmbH/go-dauth/http/authn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler(t *testing.T) {
+	jwks := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = writer.Write([]byte(`{"keys":[]}`))
+	}))
+	defer jwks.Close()
+
+	cfg := defaultConfig()
+	cfg.TrustedIssuers = []string{jwks.URL}
+	cfg.PrewarmIssuers = []string{jwks.URL + "/realms/test"}
+	cfg.HeaderSigningKeyId = "k1"
+	cfg.HeaderSigningKeys = map[string]string{"k1": testSigningKey}
+
+	jwksManager := authn.NewJwksManager()
+	defer jwksManager.Close()
+
+	h, err := newHandler(cfg, jwksManager)
+	require.NoError(t, err)
+
+	get := func(path string) int {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		return rec.Code
+	}
+
+	assert.Equal(t, 200, get("/healthz"))
+	assert.Equal(t, 503, get("/readyz"), "must not be ready before prewarming")
+	assert.Equal(t, 401, get("/"), "auth endpoint must reject requests without token")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	h.prewarm(ctx, jwksManager, cfg.PrewarmIssuers)
+
+	assert.Equal(t, 200, get("/readyz"))
+}
@@ -0,0 +1,258 @@
+package authclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/DEXPRO-Solutions-GmbH/go-dauth/http/authn"
+	"github.com/DEXPRO-Solutions-GmbH/go-dauth/http/authserver"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+var (
+	ErrUntrustedIssuer  = errors.New("issuer is not trusted")
+	ErrNoTrustedIssuers = errors.New("at least one trusted issuer is required")
+)
+
+const (
+	// defaultMaxIssuers is the default maximum number of realms TokenSources caches token sources for.
+	defaultMaxIssuers = 100
+	// defaultMaxExchangedTokens is the default maximum number of tokens TokenExchanger caches.
+	defaultMaxExchangedTokens = 10000
+)
+
+// Credentials are the credentials of a confidential Keycloak client.
+type Credentials struct {
+	ClientId     string
+	ClientSecret string
+	// Scopes are requested in addition to the default scopes of the client.
+	Scopes []string
+}
+
+// CredentialsFunc returns the client credentials to use in the realm of the given issuer. Since each realm has its
+// own clients, services calling APIs of multiple tenants usually hold one client per realm.
+type CredentialsFunc func(issuer string) (Credentials, error)
+
+// StaticCredentials returns a CredentialsFunc which uses the same credentials in all realms.
+func StaticCredentials(clientId string, clientSecret string, scopes ...string) CredentialsFunc {
+	return func(issuer string) (Credentials, error) {
+		return Credentials{ClientId: clientId, ClientSecret: clientSecret, Scopes: scopes}, nil
+	}
+}
+
+// Option configures optional behaviour of TokenSources and TokenExchanger.
+type Option func(config *clientConfig)
+
+// WithTrustedIssuers restricts requests to issuers starting with any of the given base URLs, like
+// authn.NewKeycloakIssuersKeyfunc. This prevents sending client secrets to arbitrary servers if the issuer is derived
+// from request data. This option is required.
+func WithTrustedIssuers(trustedIssuerBaseUrls ...string) Option {
+	return func(config *clientConfig) {
+		config.trustedIssuerBaseUrls = trustedIssuerBaseUrls
+	}
+}
+
+// WithHTTPClient sets the client used to call token endpoints. Defaults to http.DefaultClient.
+func WithHTTPClient(client *http.Client) Option {
+	return func(config *clientConfig) {
+		config.client = client
+	}
+}
+
+// WithMaxIssuers sets the maximum number of realms TokenSources caches token sources for. Defaults to 100.
+func WithMaxIssuers(maxIssuers int) Option {
+	return func(config *clientConfig) {
+		config.maxIssuers = maxIssuers
+	}
+}
+
+// WithMaxExchangedTokens sets the maximum number of exchanged tokens TokenExchanger caches. Defaults to 10000.
+func WithMaxExchangedTokens(maxTokens int) Option {
+	return func(config *clientConfig) {
+		config.maxExchangedTokens = maxTokens
+	}
+}
+
+// clientConfig is the configuration shared by all types calling token endpoints as a client.
+type clientConfig struct {
+	credentials           CredentialsFunc
+	trustedIssuerBaseUrls []string
+	client                *http.Client
+	maxIssuers            int
+	maxExchangedTokens    int
+}
+
+// newClientConfig applies the given options. Returns ErrNoTrustedIssuers if WithTrustedIssuers is missing.
+func newClientConfig(credentials CredentialsFunc, opts []Option) (clientConfig, error) {
+	config := clientConfig{
+		credentials:        credentials,
+		client:             http.DefaultClient,
+		maxIssuers:         defaultMaxIssuers,
+		maxExchangedTokens: defaultMaxExchangedTokens,
+	}
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	if len(config.trustedIssuerBaseUrls) == 0 {
+		return clientConfig{}, ErrNoTrustedIssuers
+	}
+	for _, baseUrl := range config.trustedIssuerBaseUrls {
+		if err := authn.ValidateIssuerBaseUrl(baseUrl); err != nil {
+			return clientConfig{}, err
+		}
+	}
+
+	return config, nil
+}
+
+// oauth2Config returns the configuration of the client in the realm of the given issuer.
+func (c *clientConfig) oauth2Config(issuer string) (*clientcredentials.Config, error) {
+	if !authn.IsTrustedIssuer(issuer, c.trustedIssuerBaseUrls) {
+		return nil, ErrUntrustedIssuer
+	}
+
+	credentials, err := c.credentials(issuer)
+	if err != nil {
+		return nil, fmt.Errorf("getting client credentials for issuer '%s' failed: %w", issuer, err)
+	}
+
+	return &clientcredentials.Config{
+		ClientID:     credentials.ClientId,
+		ClientSecret: credentials.ClientSecret,
+		TokenURL:     authn.KeycloakTokenURL(issuer),
+		Scopes:       credentials.Scopes,
+	}, nil
+}
+
+// context returns a context passing the HTTP client to the oauth2 package.
+func (c *clientConfig) context(ctx context.Context) context.Context {
+	return context.WithValue(ctx, oauth2.HTTPClient, c.client)
+}
+
+// TokenSources provides cached client credentials token sources, mapped by the realm issuer.
+//
+// Tokens are requested at the token endpoint of the realm (see authn.KeycloakTokenURL), reused until shortly before
+// they expire and refreshed automatically. At most WithMaxIssuers token sources are cached, an arbitrary one is
+// evicted if more realms are used.
+type TokenSources struct {
+	config clientConfig
+
+	lock    sync.Mutex
+	sources map[string]oauth2.TokenSource
+}
+
+// NewTokenSources creates TokenSources for the given credentials. Returns ErrNoTrustedIssuers if WithTrustedIssuers
+// is missing.
+func NewTokenSources(credentials CredentialsFunc, opts ...Option) (*TokenSources, error) {
+	config, err := newClientConfig(credentials, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenSources{
+		config:  config,
+		sources: map[string]oauth2.TokenSource{},
+	}, nil
+}
+
+// TokenSource returns the token source of the realm of the given issuer.
+func (s *TokenSources) TokenSource(issuer string) (oauth2.TokenSource, error) {
+	issuer = strings.TrimSuffix(issuer, "/")
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if source, ok := s.sources[issuer]; ok {
+		return source, nil
+	}
+
+	config, err := s.config.oauth2Config(issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	// The context is only used to pass the HTTP client, token requests must not be bound to a single call
+	source := config.TokenSource(s.config.context(context.Background()))
+	for evict := range s.sources {
+		if len(s.sources) < s.config.maxIssuers {
+			break
+		}
+		delete(s.sources, evict)
+	}
+	s.sources[issuer] = source
+
+	return source, nil
+}
+
+// Token returns a valid token of the realm of the given issuer.
+func (s *TokenSources) Token(issuer string) (*oauth2.Token, error) {
+	source, err := s.TokenSource(issuer)
+	if err != nil {
+		return nil, err
+	}
+	return source.Token()
+}
+
+// IssuerFunc determines the realm issuer whose token is used for an outgoing request.
+type IssuerFunc func(request *http.Request) (string, error)
+
+// StaticIssuer returns an IssuerFunc which always uses the given issuer.
+func StaticIssuer(issuer string) IssuerFunc {
+	return func(request *http.Request) (string, error) {
+		return issuer, nil
+	}
+}
+
+// ContextIssuer is an IssuerFunc using the issuer of the authn.Jwt or authserver.Header on the request context. Use
+// this to call APIs in the realm of the user of the incoming request.
+func ContextIssuer(request *http.Request) (string, error) {
+	obj := authserver.GetContextJwt(request.Context())
+	if obj == nil {
+		return "", errors.New("no jwt on request context")
+	}
+	return obj.Issuer, nil
+}
+
+// ClientCredentialsTransport is a http.RoundTripper setting a client credentials token as bearer token on requests.
+type ClientCredentialsTransport struct {
+	sources *TokenSources
+	issuer  IssuerFunc
+	base    http.RoundTripper
+}
+
+// NewClientCredentialsTransport creates a ClientCredentialsTransport using the token of the realm returned by issuer.
+// If base is nil, http.DefaultTransport is used.
+func NewClientCredentialsTransport(sources *TokenSources, issuer IssuerFunc, base http.RoundTripper) *ClientCredentialsTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &ClientCredentialsTransport{sources: sources, issuer: issuer, base: base}
+}
+
+func (t *ClientCredentialsTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	issuer, err := t.issuer(request)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := t.sources.Token(issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.base.RoundTrip(withBearerToken(request, token.AccessToken))
+}
+
+// withBearerToken returns a copy of the request with the given bearer token. RoundTrippers must not modify the
+// original request.
+func withBearerToken(request *http.Request, token string) *http.Request {
+	clone := request.Clone(request.Context())
+	clone.Header.Set("Authorization", "Bearer "+token)
+	return clone
+}
@@ -0,0 +1,134 @@
+package authclient
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/DEXPRO-Solutions-GmbH/go-dauth/http/authn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestKeycloak starts a token endpoint issuing tokens named after the realm and client. It returns the number of
+// token requests per realm.
+func newTestKeycloak(t *testing.T) (*httptest.Server, map[string]int) {
+	var lock sync.Mutex
+	requests := map[string]int{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		clientId, _, ok := request.BasicAuth()
+		if !ok {
+			require.NoError(t, request.ParseForm())
+			clientId = request.PostForm.Get("client_id")
+		}
+
+		lock.Lock()
+		requests[request.URL.Path]++
+		lock.Unlock()
+
+		writer.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(writer).Encode(map[string]any{
+			"access_token": clientId + "@" + request.URL.Path,
+			"token_type":   "Bearer",
+			"expires_in":   300,
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	return server, requests
+}
+
+func TestTokenSources(t *testing.T) {
+	keycloak, requests := newTestKeycloak(t)
+
+	sources, err := NewTokenSources(func(issuer string) (Credentials, error) {
+		return Credentials{ClientId: authn.KeycloakRealm(issuer) + "-client", ClientSecret: "secret"}, nil
+	}, WithTrustedIssuers(keycloak.URL+"/realms/"), WithMaxIssuers(2))
+	require.NoError(t, err)
+
+	t.Run("requires trusted issuers", func(t *testing.T) {
+		_, err := NewTokenSources(StaticCredentials("client", "secret"))
+		assert.ErrorIs(t, err, ErrNoTrustedIssuers)
+
+		_, err = NewTokenSources(StaticCredentials("client", "secret"), WithTrustedIssuers("https://auth.dexpro.de/realms/../"))
+		assert.Error(t, err)
+	})
+
+	t.Run("caches tokens per realm", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			token, err := sources.Token(keycloak.URL + "/realms/a")
+			require.NoError(t, err)
+			assert.Equal(t, "a-client@/realms/a/protocol/openid-connect/token", token.AccessToken)
+		}
+
+		token, err := sources.Token(keycloak.URL + "/realms/b/")
+		require.NoError(t, err)
+		assert.Equal(t, "b-client@/realms/b/protocol/openid-connect/token", token.AccessToken)
+
+		assert.Equal(t, 1, requests["/realms/a/protocol/openid-connect/token"])
+		assert.Equal(t, 1, requests["/realms/b/protocol/openid-connect/token"])
+	})
+
+	t.Run("rejects untrusted issuers", func(t *testing.T) {
+		_, err := sources.Token("https://evil.com/realms/a")
+		assert.ErrorIs(t, err, ErrUntrustedIssuer)
+	})
+
+	t.Run("limits cached realms", func(t *testing.T) {
+		for _, realm := range []string{"c", "d", "e"} {
+			_, err := sources.Token(keycloak.URL + "/realms/" + realm)
+			require.NoError(t, err)
+		}
+		assert.Len(t, sources.sources, 2)
+	})
+}
+
+func TestClientCredentialsTransport(t *testing.T) {
+	keycloak, _ := newTestKeycloak(t)
+	sources, err := NewTokenSources(StaticCredentials("client", "secret"), WithTrustedIssuers(keycloak.URL))
+	require.NoError(t, err)
+
+	api := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = writer.Write([]byte(request.Header.Get("Authorization")))
+	}))
+	defer api.Close()
+
+	call := func(t *testing.T, client *http.Client, ctx context.Context) (string, error) {
+		request, err := http.NewRequestWithContext(ctx, "GET", api.URL, nil)
+		require.NoError(t, err)
+
+		response, err := client.Do(request)
+		if err != nil {
+			return "", err
+		}
+		defer response.Body.Close()
+
+		body, err := io.ReadAll(response.Body)
+		return string(body), err
+	}
+
+	t.Run("static issuer", func(t *testing.T) {
+		client := &http.Client{Transport: NewClientCredentialsTransport(sources, StaticIssuer(keycloak.URL+"/realms/a"), nil)}
+
+		authorization, err := call(t, client, context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "Bearer client@/realms/a/protocol/openid-connect/token", authorization)
+	})
+
+	t.Run("issuer of request context", func(t *testing.T) {
+		client := &http.Client{Transport: NewClientCredentialsTransport(sources, ContextIssuer, nil)}
+
+		_, err := call(t, client, context.Background())
+		assert.Error(t, err)
+
+		ctx := authn.SetCtxJwt(context.Background(), &authn.Jwt{Issuer: keycloak.URL + "/realms/b"})
+		authorization, err := call(t, client, ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "Bearer client@/realms/b/protocol/openid-connect/token", authorization)
+	})
+}
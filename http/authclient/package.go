@@ -0,0 +1,3 @@
+// Package authclient implements authentication of outgoing requests from DEXPRO services to other APIs, either as
+// the service itself (client credentials) or on behalf of the user of an incoming request.
+package authclient
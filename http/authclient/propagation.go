@@ -0,0 +1,92 @@
+package authclient
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/DEXPRO-Solutions-GmbH/go-dauth/http/authserver"
+)
+
+var (
+	ErrNoToken        = errors.New("no token to propagate on request context")
+	ErrHostNotAllowed = errors.New("token propagation to host not allowed")
+)
+
+// PropagationOption configures optional behaviour of a PropagationTransport.
+type PropagationOption func(transport *PropagationTransport)
+
+// WithAllowedHosts restricts token propagation to the given hosts. Hosts starting with "*." match all subdomains,
+// e.g. "*.dexpro.de". Requests to other hosts fail with ErrHostNotAllowed.
+func WithAllowedHosts(hosts ...string) PropagationOption {
+	return func(transport *PropagationTransport) {
+		for _, host := range hosts {
+			transport.allowedHosts = append(transport.allowedHosts, strings.ToLower(host))
+		}
+	}
+}
+
+// PropagationTransport is a http.RoundTripper which calls APIs on behalf of the user of an incoming request by
+// setting the user's token as bearer token.
+//
+// The token is read from the authn.Jwt on the request context, as set by authn.JwtMiddleware, or from the
+// authserver.Header if the AuthServer forwards tokens (see authserver.WithTokenForwarding). Requests without token
+// fail with ErrNoToken. Requests which already carry an Authorization header are sent unchanged.
+//
+// Since propagated tokens are valid for all audiences of the original token, consider restricting the hosts via
+// WithAllowedHosts or exchanging tokens instead.
+type PropagationTransport struct {
+	base         http.RoundTripper
+	allowedHosts []string
+}
+
+// NewPropagationTransport creates a PropagationTransport. If base is nil, http.DefaultTransport is used.
+func NewPropagationTransport(base http.RoundTripper, opts ...PropagationOption) *PropagationTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	transport := &PropagationTransport{base: base}
+	for _, opt := range opts {
+		opt(transport)
+	}
+	return transport
+}
+
+func (t *PropagationTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if request.Header.Get("Authorization") != "" {
+		return t.base.RoundTrip(request)
+	}
+
+	if !t.isAllowedHost(request.URL.Hostname()) {
+		return nil, ErrHostNotAllowed
+	}
+
+	obj := authserver.GetContextJwt(request.Context())
+	if obj == nil || obj.TokenStr == "" {
+		return nil, ErrNoToken
+	}
+
+	return t.base.RoundTrip(withBearerToken(request, obj.TokenStr))
+}
+
+func (t *PropagationTransport) isAllowedHost(host string) bool {
+	if len(t.allowedHosts) == 0 {
+		return true
+	}
+	return matchesHost(host, t.allowedHosts)
+}
+
+// matchesHost reports whether the host matches any of the given patterns, see WithAllowedHosts.
+func matchesHost(host string, patterns []string) bool {
+	host = strings.ToLower(host)
+	for _, pattern := range patterns {
+		if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+			if strings.HasSuffix(host, suffix) && len(host) > len(suffix) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package authclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DEXPRO-Solutions-GmbH/go-dauth/http/authn"
+	"github.com/DEXPRO-Solutions-GmbH/go-dauth/http/authserver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPropagationTransport(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = writer.Write([]byte(request.Header.Get("Authorization")))
+	}))
+	defer api.Close()
+
+	call := func(t *testing.T, transport http.RoundTripper, ctx context.Context, authorization string) (string, error) {
+		request, err := http.NewRequestWithContext(ctx, "GET", api.URL, nil)
+		require.NoError(t, err)
+		if authorization != "" {
+			request.Header.Set("Authorization", authorization)
+		}
+
+		response, err := (&http.Client{Transport: transport}).Do(request)
+		if err != nil {
+			return "", err
+		}
+		defer response.Body.Close()
+
+		body, err := io.ReadAll(response.Body)
+		return string(body), err
+	}
+
+	jwtCtx := authn.SetCtxJwt(context.Background(), &authn.Jwt{TokenStr: "user-token"})
+
+	t.Run("propagates jwt of context", func(t *testing.T) {
+		authorization, err := call(t, NewPropagationTransport(nil), jwtCtx, "")
+		require.NoError(t, err)
+		assert.Equal(t, "Bearer user-token", authorization)
+	})
+
+	t.Run("propagates forwarded token of verified auth header", func(t *testing.T) {
+		keys, err := authserver.NewKeyRing("k1", map[string][]byte{"k1": []byte("0123456789abcdef0123456789abcdef")})
+		require.NoError(t, err)
+		signer := authserver.NewHeaderSigner(keys, 0)
+
+		request := httptest.NewRequest("GET", "/items", nil)
+		require.NoError(t, (&authserver.Header{Claims: &authn.Claims{}, TokenStr: "forwarded-token"}).SetOn(request.Header))
+		authserver.NewHeaderCodec().Sign(signer, request.Header, "GET", "/items")
+		header, err := authserver.ParseHeader(request, signer)
+		require.NoError(t, err)
+
+		authorization, err := call(t, NewPropagationTransport(nil), authserver.SetContextAuthHeader(context.Background(), header), "")
+		require.NoError(t, err)
+		assert.Equal(t, "Bearer forwarded-token", authorization)
+	})
+
+	t.Run("does not propagate tokens of unverified auth headers", func(t *testing.T) {
+		header := http.Header{}
+		require.NoError(t, (&authserver.Header{Claims: &authn.Claims{}, TokenStr: "spoofed-token"}).SetOn(header))
+		parsed, err := authserver.ParseUnsignedHeader(header)
+		require.NoError(t, err)
+
+		_, err = call(t, NewPropagationTransport(nil), authserver.SetContextAuthHeader(context.Background(), parsed), "")
+		assert.ErrorIs(t, err, ErrNoToken)
+	})
+
+	t.Run("fails without token", func(t *testing.T) {
+		_, err := call(t, NewPropagationTransport(nil), context.Background(), "")
+		assert.ErrorIs(t, err, ErrNoToken)
+	})
+
+	t.Run("keeps explicit authorization", func(t *testing.T) {
+		authorization, err := call(t, NewPropagationTransport(nil), jwtCtx, "Bearer explicit")
+		require.NoError(t, err)
+		assert.Equal(t, "Bearer explicit", authorization)
+	})
+
+	t.Run("refuses hosts not allowed", func(t *testing.T) {
+		_, err := call(t, NewPropagationTransport(nil, WithAllowedHosts("api.dexpro.de")), jwtCtx, "")
+		assert.ErrorIs(t, err, ErrHostNotAllowed)
+
+		authorization, err := call(t, NewPropagationTransport(nil, WithAllowedHosts("127.0.0.1")), jwtCtx, "")
+		require.NoError(t, err)
+		assert.Equal(t, "Bearer user-token", authorization)
+	})
+}
+
+func TestMatchesHost(t *testing.T) {
+	patterns := []string{"api.dexpro.de", "*.internal.dexpro.de"}
+
+	assert.True(t, matchesHost("api.dexpro.de", patterns))
+	assert.True(t, matchesHost("API.dexpro.de", patterns))
+	assert.True(t, matchesHost("a.internal.dexpro.de", patterns))
+	assert.False(t, matchesHost("internal.dexpro.de", patterns))
+	assert.False(t, matchesHost("evil-api.dexpro.de", patterns))
+	assert.False(t, matchesHost("api.dexpro.de.evil.com", patterns))
+}
@@ -0,0 +1,150 @@
+package authclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DEXPRO-Solutions-GmbH/go-dauth/http/authn"
+	"github.com/DEXPRO-Solutions-GmbH/go-dauth/http/authserver"
+	"golang.org/x/oauth2"
+)
+
+const (
+	grantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+	tokenTypeAccessToken   = "urn:ietf:params:oauth:token-type:access_token"
+)
+
+// TokenExchanger exchanges tokens of incoming requests for tokens of a target audience via OAuth 2.0 Token
+// Exchange (RFC 8693).
+//
+// Tokens are exchanged at the token endpoint of the realm which issued the incoming token, authenticating with the
+// client credentials of that realm. The client must be permitted to exchange tokens for the target audience in
+// Keycloak. Exchanged tokens are cached until shortly before they expire, tokens without expiry are not cached. At
+// most WithMaxExchangedTokens tokens are cached, the ones expiring first are evicted if more are exchanged.
+type TokenExchanger struct {
+	config clientConfig
+
+	lock   sync.Mutex
+	tokens map[[sha256.Size]byte]*oauth2.Token
+}
+
+// NewTokenExchanger creates a TokenExchanger for the given credentials. Returns ErrNoTrustedIssuers if
+// WithTrustedIssuers is missing.
+func NewTokenExchanger(credentials CredentialsFunc, opts ...Option) (*TokenExchanger, error) {
+	config, err := newClientConfig(credentials, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenExchanger{
+		config: config,
+		tokens: map[[sha256.Size]byte]*oauth2.Token{},
+	}, nil
+}
+
+// Exchange returns a token for the given audience on behalf of the user of the given token.
+func (e *TokenExchanger) Exchange(ctx context.Context, subject *authn.Jwt, audience string) (*oauth2.Token, error) {
+	if subject == nil || subject.TokenStr == "" {
+		return nil, ErrNoToken
+	}
+	issuer := strings.TrimSuffix(subject.Issuer, "/")
+
+	key := sha256.Sum256([]byte(issuer + "\n" + audience + "\n" + subject.TokenStr))
+	if token := e.cached(key); token != nil {
+		return token, nil
+	}
+
+	config, err := e.config.oauth2Config(issuer)
+	if err != nil {
+		return nil, err
+	}
+	config.EndpointParams = map[string][]string{
+		"grant_type":           {grantTypeTokenExchange},
+		"subject_token":        {subject.TokenStr},
+		"subject_token_type":   {tokenTypeAccessToken},
+		"requested_token_type": {tokenTypeAccessToken},
+		"audience":             {audience},
+	}
+
+	token, err := config.Token(e.config.context(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	e.store(key, token)
+	return token, nil
+}
+
+func (e *TokenExchanger) cached(key [sha256.Size]byte) *oauth2.Token {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	token, ok := e.tokens[key]
+	if !ok || !token.Valid() {
+		return nil
+	}
+	return token
+}
+
+func (e *TokenExchanger) store(key [sha256.Size]byte, token *oauth2.Token) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	for k, cached := range e.tokens {
+		if !cached.Valid() {
+			delete(e.tokens, k)
+		}
+	}
+	if token.Expiry.IsZero() {
+		return
+	}
+
+	for len(e.tokens) > 0 && len(e.tokens) >= e.config.maxExchangedTokens {
+		var evict [sha256.Size]byte
+		var expiry time.Time
+		for k, cached := range e.tokens {
+			if expiry.IsZero() || cached.Expiry.Before(expiry) {
+				evict, expiry = k, cached.Expiry
+			}
+		}
+		delete(e.tokens, evict)
+	}
+	e.tokens[key] = token
+}
+
+// ExchangeTransport is a http.RoundTripper calling APIs on behalf of the user of an incoming request with a token
+// exchanged for the audience of the API.
+//
+// The incoming token is read from the request context like PropagationTransport does. Requests which already carry an
+// Authorization header are sent unchanged.
+type ExchangeTransport struct {
+	exchanger *TokenExchanger
+	audience  string
+	base      http.RoundTripper
+}
+
+// NewExchangeTransport creates an ExchangeTransport for the given audience, usually the client id of the called API.
+// If base is nil, http.DefaultTransport is used.
+func NewExchangeTransport(exchanger *TokenExchanger, audience string, base http.RoundTripper) *ExchangeTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &ExchangeTransport{exchanger: exchanger, audience: audience, base: base}
+}
+
+func (t *ExchangeTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if request.Header.Get("Authorization") != "" {
+		return t.base.RoundTrip(request)
+	}
+
+	token, err := t.exchanger.Exchange(request.Context(), authserver.GetContextJwt(request.Context()), t.audience)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.base.RoundTrip(withBearerToken(request, token.AccessToken))
+}
@@ -0,0 +1,114 @@
+package authclient
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/DEXPRO-Solutions-GmbH/go-dauth/http/authn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestTokenExchanger(t *testing.T) {
+	var exchanges atomic.Int32
+	keycloak := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		require.NoError(t, request.ParseForm())
+		require.Equal(t, "/realms/a/protocol/openid-connect/token", request.URL.Path)
+		require.Equal(t, grantTypeTokenExchange, request.PostForm.Get("grant_type"))
+		require.Equal(t, tokenTypeAccessToken, request.PostForm.Get("subject_token_type"))
+
+		if request.PostForm.Get("subject_token") == "forbidden" {
+			writer.Header().Set("Content-Type", "application/json")
+			writer.WriteHeader(http.StatusForbidden)
+			_, _ = writer.Write([]byte(`{"error":"access_denied","error_description":"Client not allowed to exchange"}`))
+			return
+		}
+
+		exchanges.Add(1)
+		writer.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(writer).Encode(map[string]any{
+			"access_token":      request.PostForm.Get("audience") + ":" + request.PostForm.Get("subject_token"),
+			"token_type":        "Bearer",
+			"issued_token_type": tokenTypeAccessToken,
+			"expires_in":        300,
+		})
+	}))
+	defer keycloak.Close()
+
+	exchanger, err := NewTokenExchanger(StaticCredentials("gateway", "secret"), WithTrustedIssuers(keycloak.URL+"/realms/"))
+	require.NoError(t, err)
+	subject := &authn.Jwt{TokenStr: "user-token", Issuer: keycloak.URL + "/realms/a"}
+
+	t.Run("exchanges and caches tokens", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			token, err := exchanger.Exchange(context.Background(), subject, "billing")
+			require.NoError(t, err)
+			assert.Equal(t, "billing:user-token", token.AccessToken)
+		}
+		assert.Equal(t, int32(1), exchanges.Load())
+
+		token, err := exchanger.Exchange(context.Background(), subject, "storage")
+		require.NoError(t, err)
+		assert.Equal(t, "storage:user-token", token.AccessToken)
+		assert.Equal(t, int32(2), exchanges.Load())
+	})
+
+	t.Run("limits cached tokens", func(t *testing.T) {
+		bounded, err := NewTokenExchanger(StaticCredentials("gateway", "secret"),
+			WithTrustedIssuers(keycloak.URL+"/realms/"), WithMaxExchangedTokens(2))
+		require.NoError(t, err)
+
+		for _, audience := range []string{"a", "b", "c"} {
+			_, err := bounded.Exchange(context.Background(), subject, audience)
+			require.NoError(t, err)
+		}
+		assert.Len(t, bounded.tokens, 2)
+
+		exchanges.Store(0)
+		_, err = bounded.Exchange(context.Background(), subject, "c")
+		require.NoError(t, err)
+		assert.Equal(t, int32(0), exchanges.Load(), "latest token must still be cached")
+	})
+
+	t.Run("returns oauth errors", func(t *testing.T) {
+		_, err := exchanger.Exchange(context.Background(), &authn.Jwt{TokenStr: "forbidden", Issuer: subject.Issuer}, "billing")
+		var retrieveErr *oauth2.RetrieveError
+		require.ErrorAs(t, err, &retrieveErr)
+		assert.Equal(t, "access_denied", retrieveErr.ErrorCode)
+	})
+
+	t.Run("rejects untrusted issuers", func(t *testing.T) {
+		_, err := exchanger.Exchange(context.Background(), &authn.Jwt{TokenStr: "user-token", Issuer: "https://evil.com/realms/a"}, "billing")
+		assert.ErrorIs(t, err, ErrUntrustedIssuer)
+	})
+
+	t.Run("requires token", func(t *testing.T) {
+		_, err := exchanger.Exchange(context.Background(), nil, "billing")
+		assert.ErrorIs(t, err, ErrNoToken)
+	})
+
+	t.Run("transport", func(t *testing.T) {
+		api := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			_, _ = writer.Write([]byte(request.Header.Get("Authorization")))
+		}))
+		defer api.Close()
+
+		request, err := http.NewRequestWithContext(authn.SetCtxJwt(context.Background(), subject), "GET", api.URL, nil)
+		require.NoError(t, err)
+
+		client := &http.Client{Transport: NewExchangeTransport(exchanger, "billing", nil)}
+		response, err := client.Do(request)
+		require.NoError(t, err)
+		defer response.Body.Close()
+
+		body, err := io.ReadAll(response.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "Bearer billing:user-token", string(body))
+	})
+}
@@ -2,6 +2,8 @@ package authn
 
 import (
 	"errors"
+	"strings"
+
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/google/uuid"
 )
@@ -35,6 +37,9 @@ type Claims struct {
 	ClientAddress string `json:"clientAddress,omitempty"`
 
 	PreferredUsername string `json:"preferred_username,omitempty"`
+
+	// SessionId is the id of the Keycloak session the token has been issued for
+	SessionId string `json:"sid,omitempty"`
 }
 
 // Valid is the method called by the jwt library when parsing and validating a token.
@@ -87,3 +92,36 @@ func RequireExpAndIssuedAtClaims(claims jwt.RegisteredClaims) error {
 func (claims *Claims) HasTenantId() bool {
 	return claims.TenantId != uuid.Nil
 }
+
+// HasRealmRole reports whether the claims contain the given Keycloak realm role.
+func (claims *Claims) HasRealmRole(role string) bool {
+	return containsString(claims.RealmAccess["roles"], role)
+}
+
+// HasClientRole reports whether the claims contain the given Keycloak client role.
+func (claims *Claims) HasClientRole(client string, role string) bool {
+	return containsString(claims.ResourceAccess[client]["roles"], role)
+}
+
+// HasRole reports whether the claims contain the given role. Roles in the form "client:role" are looked up as
+// client roles, all others as realm roles.
+func (claims *Claims) HasRole(role string) bool {
+	if client, clientRole, found := strings.Cut(role, ":"); found {
+		return claims.HasClientRole(client, clientRole)
+	}
+	return claims.HasRealmRole(role)
+}
+
+// HasScope reports whether the space separated "scope" claim contains the given scope.
+func (claims *Claims) HasScope(scope string) bool {
+	return containsString(strings.Fields(claims.Scope), scope)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -99,3 +99,19 @@ func TestClaims_Valid(t *testing.T) {
 		})
 	})
 }
+
+func TestClaims_Roles(t *testing.T) {
+	claims := &Claims{
+		Scope:          "openid profile email",
+		RealmAccess:    map[string][]string{"roles": {"admin"}},
+		ResourceAccess: map[string]map[string][]string{"api": {"roles": {"reader"}}},
+	}
+
+	assert.True(t, claims.HasRole("admin"))
+	assert.True(t, claims.HasRole("api:reader"))
+	assert.False(t, claims.HasRole("reader"))
+	assert.False(t, claims.HasRole("api:admin"))
+	assert.True(t, claims.HasScope("profile"))
+	assert.False(t, claims.HasScope("prof"))
+	assert.False(t, (&Claims{}).HasRole("admin"))
+}
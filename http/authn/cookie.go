@@ -10,6 +10,16 @@ func AccessTokenCookieName(prefix string) string {
 	return prefix + "-at"
 }
 
+// RefreshTokenCookieName returns a standard cookie name to be used for cookies carrying refresh tokens.
+func RefreshTokenCookieName(prefix string) string {
+	return prefix + "-rt"
+}
+
+// IdTokenCookieName returns a standard cookie name to be used for cookies carrying ID tokens.
+func IdTokenCookieName(prefix string) string {
+	return prefix + "-id"
+}
+
 // GetAccessTokenCookie retrieves the access token cookie from the request.
 func GetAccessTokenCookie(request *http.Request, prefix string) (*http.Cookie, error) {
 	cookie, err := request.Cookie(AccessTokenCookieName(prefix))
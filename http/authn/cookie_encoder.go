@@ -1,7 +1,11 @@
 package authn
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
 	"encoding/base64"
+	"errors"
 	"net/http"
 )
 
@@ -50,3 +54,64 @@ func (u *Base64CookieEncoder) Decode(val []byte) ([]byte, error) {
 	}
 	return encrypted, nil
 }
+
+var errCookieDecryptionFailed = errors.New("decrypting cookie failed")
+
+// AesGcmCookieEncoder is an encoder which encrypts and authenticates values via AES-GCM before encoding them via
+// base64url. Use it for cookies whose values must not be readable by clients, e.g. refresh tokens.
+type AesGcmCookieEncoder struct {
+	aead cipher.AEAD
+}
+
+// NewAesGcmCookieEncoder creates an AesGcmCookieEncoder. The key must be 16, 24 or 32 bytes long to select AES-128,
+// AES-192 or AES-256.
+func NewAesGcmCookieEncoder(key []byte) (*AesGcmCookieEncoder, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &AesGcmCookieEncoder{aead: aead}, nil
+}
+
+func (u *AesGcmCookieEncoder) EncodeCookie(cookie *http.Cookie) error {
+	cookie.Value = string(u.Encode([]byte(cookie.Value)))
+	return nil
+}
+
+func (u *AesGcmCookieEncoder) DecodeCookie(cookie *http.Cookie) error {
+	decrypted, err := u.Decode([]byte(cookie.Value))
+	if err != nil {
+		return err
+	}
+	cookie.Value = string(decrypted)
+	return nil
+}
+
+// Encode encrypts the value with a random nonce. Panics if no randomness is available.
+func (u *AesGcmCookieEncoder) Encode(val []byte) []byte {
+	nonce := make([]byte, u.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		panic(err)
+	}
+
+	sealed := u.aead.Seal(nonce, nonce, val, nil)
+	return []byte(base64.RawURLEncoding.EncodeToString(sealed))
+}
+
+func (u *AesGcmCookieEncoder) Decode(val []byte) ([]byte, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(string(val))
+	if err != nil || len(sealed) < u.aead.NonceSize() {
+		return nil, errCookieDecryptionFailed
+	}
+
+	nonce, ciphertext := sealed[:u.aead.NonceSize()], sealed[u.aead.NonceSize():]
+	decrypted, err := u.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, errCookieDecryptionFailed
+	}
+	return decrypted, nil
+}
@@ -0,0 +1,39 @@
+package authn
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAesGcmCookieEncoder(t *testing.T) {
+	encoder, err := NewAesGcmCookieEncoder([]byte("0123456789abcdef0123456789abcdef"))
+	require.NoError(t, err)
+
+	t.Run("round trip", func(t *testing.T) {
+		encoded := encoder.Encode([]byte("secret"))
+		assert.NotContains(t, string(encoded), "secret")
+		assert.NotEqual(t, encoded, encoder.Encode([]byte("secret")))
+
+		decoded, err := encoder.Decode(encoded)
+		require.NoError(t, err)
+		assert.Equal(t, "secret", string(decoded))
+	})
+
+	t.Run("rejects tampered values", func(t *testing.T) {
+		encoded := encoder.Encode([]byte("secret"))
+		encoded[len(encoded)-2] ^= 1
+
+		_, err := encoder.Decode(encoded)
+		assert.Error(t, err)
+
+		_, err = encoder.Decode([]byte("abc"))
+		assert.Error(t, err)
+	})
+
+	t.Run("rejects invalid keys", func(t *testing.T) {
+		_, err := NewAesGcmCookieEncoder([]byte("short"))
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,169 @@
+package authn
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// DefaultCsrfHeaderName is the request header carrying the double-submit token.
+	DefaultCsrfHeaderName = "X-Csrf-Token"
+)
+
+// CsrfCookieName returns a standard cookie name to be used for cookies carrying double-submit CSRF tokens.
+func CsrfCookieName(prefix string) string {
+	return prefix + "-csrf"
+}
+
+var (
+	ErrCsrfCookieNotConfigured = errors.New("double-submit cookie not configured")
+
+	errCsrfTokenMismatch   = errors.New("csrf token mismatch")
+	errCsrfUntrustedOrigin = errors.New("request origin is not trusted")
+	errCsrfMissingOrigin   = errors.New("request origin unknown")
+)
+
+// CsrfOption configures optional behaviour of a CsrfProtection.
+type CsrfOption func(protection *CsrfProtection)
+
+// WithTrustedOrigins allows cross-origin requests from the given origins, e.g. "https://app.dexpro.de".
+func WithTrustedOrigins(origins ...string) CsrfOption {
+	return func(protection *CsrfProtection) {
+		for _, origin := range origins {
+			protection.trustedOrigins[strings.ToLower(strings.TrimSuffix(origin, "/"))] = struct{}{}
+		}
+	}
+}
+
+// WithDoubleSubmitCookie enables the double-submit pattern: Requests carrying the header headerName are accepted if
+// its value equals the value of the cookie cookieName. If headerName is empty, DefaultCsrfHeaderName is used.
+func WithDoubleSubmitCookie(cookieName string, headerName string) CsrfOption {
+	return func(protection *CsrfProtection) {
+		if headerName == "" {
+			headerName = DefaultCsrfHeaderName
+		}
+		protection.cookieName = cookieName
+		protection.headerName = headerName
+	}
+}
+
+// CsrfProtection is a middleware protecting cookie authenticated requests against cross-site request forgery.
+//
+// It must be used after JwtMiddleware since it inspects the Jwt on the request context. Requests are only checked if
+// their token has been extracted from a cookie (TokenSourceCookie) and use an unsafe method. Tokens from headers are
+// never sent automatically by browsers and are therefore not subject to CSRF.
+//
+// A checked request is accepted if any of the following applies:
+//   - the double-submit token header matches the double-submit cookie (see WithDoubleSubmitCookie)
+//   - the Sec-Fetch-Site header is "same-origin" or "none"
+//   - the Origin header matches the request host or is one of the trusted origins (see WithTrustedOrigins)
+//
+// All other checked requests are rejected with status 403.
+type CsrfProtection struct {
+	trustedOrigins map[string]struct{}
+	cookieName     string
+	headerName     string
+}
+
+func NewCsrfProtection(opts ...CsrfOption) *CsrfProtection {
+	protection := &CsrfProtection{
+		trustedOrigins: map[string]struct{}{},
+	}
+	for _, opt := range opts {
+		opt(protection)
+	}
+	return protection
+}
+
+func (c *CsrfProtection) Gin(ctx *gin.Context) {
+	if err := c.Check(ctx.Request, GetCtxJwt(ctx)); err != nil {
+		http.Error(ctx.Writer, "csrf validation failed: "+err.Error(), http.StatusForbidden)
+		ctx.Abort()
+		return
+	}
+}
+
+// Check validates the given request which has been authenticated via obj. It returns an error if the request must
+// be rejected.
+func (c *CsrfProtection) Check(request *http.Request, obj *Jwt) error {
+	if obj == nil || obj.Source != TokenSourceCookie || isSafeMethod(request.Method) {
+		return nil
+	}
+
+	if c.cookieName != "" {
+		if submitted := request.Header.Get(c.headerName); submitted != "" {
+			cookie, err := request.Cookie(c.cookieName)
+			if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(submitted)) != 1 {
+				return errCsrfTokenMismatch
+			}
+			return nil
+		}
+	}
+
+	switch request.Header.Get("Sec-Fetch-Site") {
+	case "same-origin", "none":
+		return nil
+	}
+
+	origin := request.Header.Get("Origin")
+	if origin == "" {
+		return errCsrfMissingOrigin
+	}
+	if c.isTrustedOrigin(request, origin) {
+		return nil
+	}
+	return errCsrfUntrustedOrigin
+}
+
+func (c *CsrfProtection) isTrustedOrigin(request *http.Request, origin string) bool {
+	origin = strings.ToLower(origin)
+	if _, ok := c.trustedOrigins[origin]; ok {
+		return true
+	}
+
+	parsed, err := url.Parse(origin)
+	if err != nil || parsed.Host == "" {
+		return false
+	}
+	return strings.EqualFold(parsed.Host, request.Host)
+}
+
+// IssueToken generates a new random double-submit token and sets it as cookie on the response. The cookie is
+// readable by scripts so that clients are able to copy it into the request header.
+//
+// Returns ErrCsrfCookieNotConfigured if the double-submit pattern has not been enabled via WithDoubleSubmitCookie.
+func (c *CsrfProtection) IssueToken(writer http.ResponseWriter) (string, error) {
+	if c.cookieName == "" {
+		return "", ErrCsrfCookieNotConfigured
+	}
+
+	token, err := randomString()
+	if err != nil {
+		return "", err
+	}
+
+	http.SetCookie(writer, &http.Cookie{
+		Name:     c.cookieName,
+		Value:    token,
+		Path:     "/",
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	return token, nil
+}
+
+// isSafeMethod reports whether the given method is safe as defined by RFC 9110 section 9.2.1.
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,122 @@
+package authn
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCsrfProtection_Check(t *testing.T) {
+	const cookieName = "test-csrf"
+
+	protection := NewCsrfProtection(
+		WithTrustedOrigins("https://app.dexpro.de/"),
+		WithDoubleSubmitCookie(cookieName, ""),
+	)
+
+	cookieJwt := &Jwt{Source: TokenSourceCookie}
+	headerJwt := &Jwt{Source: TokenSourceHeader}
+
+	newRequest := func(method string) *http.Request {
+		return httptest.NewRequest(method, "https://api.dexpro.de/items", nil)
+	}
+
+	t.Run("ignores safe methods", func(t *testing.T) {
+		assert.NoError(t, protection.Check(newRequest("GET"), cookieJwt))
+	})
+
+	t.Run("ignores tokens from headers", func(t *testing.T) {
+		assert.NoError(t, protection.Check(newRequest("POST"), headerJwt))
+	})
+
+	t.Run("ignores unauthenticated requests", func(t *testing.T) {
+		assert.NoError(t, protection.Check(newRequest("POST"), nil))
+	})
+
+	t.Run("rejects request without origin information", func(t *testing.T) {
+		assert.Error(t, protection.Check(newRequest("POST"), cookieJwt))
+	})
+
+	t.Run("double submit", func(t *testing.T) {
+		t.Run("accepts matching token", func(t *testing.T) {
+			request := newRequest("POST")
+			request.AddCookie(&http.Cookie{Name: cookieName, Value: "token"})
+			request.Header.Set(DefaultCsrfHeaderName, "token")
+			assert.NoError(t, protection.Check(request, cookieJwt))
+		})
+
+		t.Run("rejects mismatching token", func(t *testing.T) {
+			request := newRequest("POST")
+			request.AddCookie(&http.Cookie{Name: cookieName, Value: "token"})
+			request.Header.Set(DefaultCsrfHeaderName, "other")
+			request.Header.Set("Sec-Fetch-Site", "same-origin")
+			assert.Error(t, protection.Check(request, cookieJwt))
+		})
+	})
+
+	t.Run("fetch metadata", func(t *testing.T) {
+		for site, valid := range map[string]bool{"same-origin": true, "none": true, "same-site": false, "cross-site": false} {
+			request := newRequest("POST")
+			request.Header.Set("Sec-Fetch-Site", site)
+			if valid {
+				assert.NoError(t, protection.Check(request, cookieJwt), site)
+			} else {
+				assert.Error(t, protection.Check(request, cookieJwt), site)
+			}
+		}
+	})
+
+	t.Run("origin", func(t *testing.T) {
+		for origin, valid := range map[string]bool{
+			"https://api.dexpro.de":  true,
+			"https://app.dexpro.de":  true,
+			"https://evil.dexpro.de": false,
+			"null":                   false,
+		} {
+			request := newRequest("DELETE")
+			request.Header.Set("Origin", origin)
+			if valid {
+				assert.NoError(t, protection.Check(request, cookieJwt), origin)
+			} else {
+				assert.Error(t, protection.Check(request, cookieJwt), origin)
+			}
+		}
+	})
+}
+
+func TestCsrfProtection_Gin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+
+	rec := httptest.NewRecorder()
+	ctx := gin.CreateTestContextOnly(rec, engine)
+	ctx.Request = httptest.NewRequest("POST", "/", nil)
+	SetCtxJwtGin(ctx, &Jwt{Source: TokenSourceCookie})
+
+	NewCsrfProtection().Gin(ctx)
+	assert.Equal(t, 403, rec.Code)
+	assert.True(t, ctx.IsAborted())
+}
+
+func TestCsrfProtection_IssueToken(t *testing.T) {
+	t.Run("requires double-submit cookie", func(t *testing.T) {
+		_, err := NewCsrfProtection().IssueToken(httptest.NewRecorder())
+		assert.ErrorIs(t, err, ErrCsrfCookieNotConfigured)
+	})
+
+	protection := NewCsrfProtection(WithDoubleSubmitCookie(CsrfCookieName("test"), ""))
+
+	rec := httptest.NewRecorder()
+	token, err := protection.IssueToken(rec)
+	require.NoError(t, err)
+	assert.NotEmpty(t, token)
+
+	cookies := rec.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, "test-csrf", cookies[0].Name)
+	assert.Equal(t, token, cookies[0].Value)
+}
@@ -3,15 +3,55 @@ package authn
 import (
 	"github.com/golang-jwt/jwt/v4"
 	"net/http"
+	"time"
 )
 
 // AuthStack is responsible for performing authentication in our APIs.
 type AuthStack struct {
 	extractChain TokenExtractorChain
+	chainPolicy  ExtractorChainPolicy
 	keyfunc      jwt.Keyfunc
+	audiences    []string
+	cache        *TokenCache
+	revocations  RevocationChecker
 }
 
-func NewDefaultAuthStack(trustedIssuerBaseUrl string, cookieName string) *AuthStack {
+// AuthStackOption configures optional behaviour of an AuthStack.
+type AuthStackOption func(stack *AuthStack)
+
+// WithExtractorChainPolicy sets the ExtractorChainPolicy used when extracting tokens from requests.
+func WithExtractorChainPolicy(policy ExtractorChainPolicy) AuthStackOption {
+	return func(stack *AuthStack) {
+		stack.chainPolicy = policy
+	}
+}
+
+// WithAudiences makes the AuthStack only accept tokens whose "aud" claim contains any of the given audiences.
+func WithAudiences(audiences ...string) AuthStackOption {
+	return func(stack *AuthStack) {
+		stack.audiences = audiences
+	}
+}
+
+// WithTokenCache makes the AuthStack cache validated tokens in the given cache. See TokenCache.
+//
+// When using NewDefaultAuthStack, the cache is purged automatically when signing keys change. Otherwise, use
+// TokenCache.PurgeOnKeyChange.
+func WithTokenCache(cache *TokenCache) AuthStackOption {
+	return func(stack *AuthStack) {
+		stack.cache = cache
+	}
+}
+
+// WithRevocations makes the AuthStack reject tokens which the given RevocationChecker reports as revoked, e.g. a
+// MemoryRevocationStore. Revocations are also checked for cached tokens.
+func WithRevocations(checker RevocationChecker) AuthStackOption {
+	return func(stack *AuthStack) {
+		stack.revocations = checker
+	}
+}
+
+func NewDefaultAuthStack(trustedIssuerBaseUrl string, cookieName string, opts ...AuthStackOption) *AuthStack {
 	jwksManager := NewJwksManager()
 
 	keyfunc := NewKeycloakKeyfunc(trustedIssuerBaseUrl, jwksManager)
@@ -20,23 +60,86 @@ func NewDefaultAuthStack(trustedIssuerBaseUrl string, cookieName string) *AuthSt
 	extractor = extractor.Append(NewBearerHeaderTokenExtractor())
 	extractor = extractor.Append(NewJwtCookieExtractor(cookieName, NewBase64CookieEncoder()))
 
-	return &AuthStack{
-		extractChain: extractor,
+	stack := NewAuthStack(extractor, keyfunc, opts...)
+	if stack.cache != nil {
+		stack.cache.PurgeOnKeyChange(jwksManager)
+	}
+
+	return stack
+}
+
+// NewAuthStack creates an AuthStack from the given extractors and keyfunc. Most services should use
+// NewDefaultAuthStack instead.
+func NewAuthStack(extractChain TokenExtractorChain, keyfunc jwt.Keyfunc, opts ...AuthStackOption) *AuthStack {
+	stack := &AuthStack{
+		extractChain: extractChain,
 		keyfunc:      keyfunc,
 	}
+	for _, opt := range opts {
+		opt(stack)
+	}
+
+	return stack
 }
 
 func (d *AuthStack) ExtractRequestToken(request *http.Request) (string, error) {
-	return d.extractChain.ExtractRequestToken(request)
+	return d.extractChain.WithPolicy(d.chainPolicy).ExtractRequestToken(request)
+}
+
+func (d *AuthStack) ExtractRequestTokenSource(request *http.Request) (string, TokenSource, error) {
+	return d.extractChain.WithPolicy(d.chainPolicy).ExtractRequestTokenSource(request)
 }
 
 func (d *AuthStack) ParseToken(tokenString string) (*jwt.Token, *Claims, error) {
+	token, claims, _, err := d.ParseTokenValidatedAt(tokenString)
+	return token, claims, err
+}
+
+// ParseTokenValidatedAt is like ParseToken but also returns the time the token has been validated at, which is
+// earlier than now for tokens served from the TokenCache.
+func (d *AuthStack) ParseTokenValidatedAt(tokenString string) (*jwt.Token, *Claims, time.Time, error) {
+	var parser TokenParser = parserFunc(d.parseToken)
+	if d.cache != nil {
+		parser = NewCachingTokenParser(parser, d.cache)
+	}
+
+	token, claims, validatedAt, err := ParseTokenValidatedAt(parser, tokenString)
+	if err != nil {
+		return nil, nil, time.Time{}, err
+	}
+
+	// Checked after the cache, since tokens may be revoked while they are cached
+	if d.revocations != nil && d.revocations.IsRevoked(claims) {
+		return nil, nil, time.Time{}, errTokenRevoked
+	}
+
+	return token, claims, validatedAt, nil
+}
+
+func (d *AuthStack) parseToken(tokenString string) (*jwt.Token, *Claims, error) {
 	claims := &Claims{}
-	if token, err := jwt.ParseWithClaims(tokenString, claims, d.keyfunc); err != nil {
+	token, err := jwt.ParseWithClaims(tokenString, claims, d.keyfunc)
+	if err != nil {
 		return nil, nil, err
-	} else {
-		return token, claims, nil
 	}
+
+	if !d.hasAudience(claims) {
+		return nil, nil, jwt.NewValidationError("token has invalid audience", jwt.ValidationErrorAudience)
+	}
+
+	return token, claims, nil
+}
+
+func (d *AuthStack) hasAudience(claims *Claims) bool {
+	if len(d.audiences) == 0 {
+		return true
+	}
+	for _, audience := range d.audiences {
+		if claims.VerifyAudience(audience, true) {
+			return true
+		}
+	}
+	return false
 }
 
 func (d *AuthStack) ValidateToken(token *jwt.Token) (bool, error) {
@@ -0,0 +1,53 @@
+package authn
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthStack_ParseToken(t *testing.T) {
+	key := []byte("test-signing-key")
+	keyfunc := func(token *jwt.Token) (interface{}, error) {
+		return key, nil
+	}
+
+	newToken := func(audience ...string) string {
+		claims := &Claims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Audience:  audience,
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+				IssuedAt:  jwt.NewNumericDate(time.Now().Add(-time.Minute)),
+			},
+			TenantId:   uuid.New(),
+			TenantName: "test",
+		}
+		tokenStr, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+		require.NoError(t, err)
+		return tokenStr
+	}
+
+	t.Run("accepts any audience by default", func(t *testing.T) {
+		stack := NewAuthStack(NewTokenExtractorChain(), keyfunc)
+		_, _, err := stack.ParseToken(newToken("other"))
+		assert.NoError(t, err)
+	})
+
+	t.Run("audiences", func(t *testing.T) {
+		stack := NewAuthStack(NewTokenExtractorChain(), keyfunc, WithAudiences("api", "web"))
+
+		_, _, err := stack.ParseToken(newToken("other", "web"))
+		assert.NoError(t, err)
+
+		_, _, err = stack.ParseToken(newToken("other"))
+		var validationErr *jwt.ValidationError
+		assert.ErrorAs(t, err, &validationErr)
+
+		_, _, err = stack.ParseToken(newToken())
+		assert.Error(t, err)
+	})
+}
@@ -1,7 +1,19 @@
 package authn
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
 	ErrAuthTokenMissing = errors.New("auth token missing")
+
+	// ErrInvalidRequest is returned (possibly wrapped) by token extractors if a request carries malformed
+	// authentication information. It corresponds to the "invalid_request" error code of RFC 6750 section 3.1.
+	ErrInvalidRequest = errors.New("invalid_request")
+
+	// ErrUnsupportedScheme is returned by BearerHeaderTokenExtractor if the Authorization header uses another scheme
+	// than "Bearer". A TokenExtractorChain treats it as "no token" and only returns it if no other extractor yields a
+	// token.
+	ErrUnsupportedScheme = fmt.Errorf("%w: unsupported authorization scheme", ErrInvalidRequest)
 )
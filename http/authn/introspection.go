@@ -0,0 +1,199 @@
+package authn
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// defaultIntrospectionCacheTTL is the default duration for which active introspection results are cached.
+const defaultIntrospectionCacheTTL = 10 * time.Second
+
+var errTokenInactive = jwt.NewValidationError("token is not active", jwt.ValidationErrorClaimsInvalid)
+
+// IntrospectionOption configures optional behaviour of an IntrospectionParser.
+type IntrospectionOption func(parser *IntrospectionParser)
+
+// WithIntrospectionCacheTTL sets the duration for which active tokens are cached. Zero disables the cache, so that
+// revocations take effect immediately. Defaults to 10 seconds.
+func WithIntrospectionCacheTTL(ttl time.Duration) IntrospectionOption {
+	return func(parser *IntrospectionParser) {
+		parser.cacheTTL = ttl
+	}
+}
+
+// WithIntrospectionHTTPClient sets the client used to call the introspection endpoint. Defaults to a client with a
+// 10s timeout.
+func WithIntrospectionHTTPClient(client *http.Client) IntrospectionOption {
+	return func(parser *IntrospectionParser) {
+		parser.client = client
+	}
+}
+
+// WithIntrospectionTrustedIssuers makes the IntrospectionParser introspect JWTs at the realm of their issuer if it
+// is trusted according to IsTrustedIssuer. Opaque tokens and JWTs of other issuers are introspected at the default
+// issuer.
+func WithIntrospectionTrustedIssuers(trustedIssuerBaseUrls ...string) IntrospectionOption {
+	return func(parser *IntrospectionParser) {
+		parser.trustedIssuerBaseUrls = trustedIssuerBaseUrls
+	}
+}
+
+// IntrospectionParser is a TokenParser validating tokens via OAuth 2.0 Token Introspection (RFC 7662) at the
+// introspection endpoint of a Keycloak realm.
+//
+// Use it for opaque tokens or if revocations must take effect in real time. Since each request is checked at the
+// issuer, introspection is considerably slower than local validation. See TokenParserChain to introspect tokens in
+// addition to local validation.
+//
+// Returned tokens are not signature-verified jwt.Token objects: their claims are the ones of the introspection
+// response, which must be valid according to Claims.Valid and carry the issuer of the introspected realm.
+type IntrospectionParser struct {
+	issuer                string
+	trustedIssuerBaseUrls []string
+	clientId              string
+	clientSecret          string
+	client                *http.Client
+	cacheTTL              time.Duration
+
+	parser TokenParser
+}
+
+// NewIntrospectionParser creates an IntrospectionParser calling the introspection endpoint of the given realm issuer
+// with the given client credentials.
+func NewIntrospectionParser(issuer string, clientId string, clientSecret string, opts ...IntrospectionOption) *IntrospectionParser {
+	parser := &IntrospectionParser{
+		issuer:       strings.TrimSuffix(issuer, "/"),
+		clientId:     clientId,
+		clientSecret: clientSecret,
+		client:       &http.Client{Timeout: 10 * time.Second},
+		cacheTTL:     defaultIntrospectionCacheTTL,
+	}
+	for _, opt := range opts {
+		opt(parser)
+	}
+
+	parser.parser = parserFunc(parser.introspect)
+	if parser.cacheTTL > 0 {
+		parser.parser = NewCachingTokenParser(parser.parser, NewTokenCache(WithTokenCacheMaxTTL(parser.cacheTTL)))
+	}
+
+	return parser
+}
+
+func (p *IntrospectionParser) ParseToken(tokenString string) (*jwt.Token, *Claims, error) {
+	return p.parser.ParseToken(tokenString)
+}
+
+// ParseTokenValidatedAt is like ParseToken but also returns the time the token has been introspected at.
+func (p *IntrospectionParser) ParseTokenValidatedAt(tokenString string) (*jwt.Token, *Claims, time.Time, error) {
+	return ParseTokenValidatedAt(p.parser, tokenString)
+}
+
+func (p *IntrospectionParser) introspect(tokenString string) (*jwt.Token, *Claims, error) {
+	token := &jwt.Token{Raw: tokenString}
+
+	issuer := p.issuer
+	if unverified, _, err := jwt.NewParser().ParseUnverified(tokenString, &Claims{}); err == nil {
+		token.Header = unverified.Header
+		token.Method = unverified.Method
+
+		claimsIssuer := strings.TrimSuffix(unverified.Claims.(*Claims).Issuer, "/")
+		if IsTrustedIssuer(claimsIssuer, p.trustedIssuerBaseUrls) {
+			issuer = claimsIssuer
+		}
+	}
+
+	form := url.Values{}
+	form.Set("token", tokenString)
+	form.Set("token_type_hint", "access_token")
+
+	request, err := http.NewRequest(http.MethodPost, KeycloakIntrospectionURL(issuer), strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	request.SetBasicAuth(url.QueryEscape(p.clientId), url.QueryEscape(p.clientSecret))
+
+	response, err := p.client.Do(request)
+	if err != nil {
+		return nil, nil, fmt.Errorf("introspecting token failed: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		oauthErr := &OAuthError{}
+		_ = json.NewDecoder(response.Body).Decode(oauthErr)
+		oauthErr.StatusCode = response.StatusCode
+		return nil, nil, oauthErr
+	}
+
+	var result struct {
+		Active bool `json:"active"`
+		Claims
+	}
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return nil, nil, fmt.Errorf("decoding introspection response failed: %w", err)
+	}
+
+	if !result.Active {
+		return nil, nil, errTokenInactive
+	}
+
+	// The token endpoint only vouches for tokens of its own realm
+	claims := &result.Claims
+	if strings.TrimSuffix(claims.Issuer, "/") != issuer {
+		return nil, nil, jwt.NewValidationError("introspected token has unexpected issuer", jwt.ValidationErrorIssuer)
+	}
+	if err := claims.Valid(); err != nil {
+		var validationErr *jwt.ValidationError
+		if errors.As(err, &validationErr) {
+			return nil, nil, err
+		}
+		return nil, nil, jwt.NewValidationError(err.Error(), jwt.ValidationErrorClaimsInvalid)
+	}
+
+	token.Claims = claims
+	token.Valid = true
+	return token, claims, nil
+}
+
+// TokenParserChain is a TokenParser which requires tokens to be accepted by all of its parsers, e.g. an AuthStack
+// verifying signatures locally followed by an IntrospectionParser checking for revocation.
+//
+// The token and claims of the first parser are returned.
+type TokenParserChain []TokenParser
+
+func NewTokenParserChain(parsers ...TokenParser) TokenParserChain {
+	return parsers
+}
+
+func (c TokenParserChain) ParseToken(tokenString string) (*jwt.Token, *Claims, error) {
+	if len(c) == 0 {
+		return nil, nil, errors.New("no token parsers configured")
+	}
+
+	var token *jwt.Token
+	var claims *Claims
+	for i, parser := range c {
+		t, cl, err := parser.ParseToken(tokenString)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !t.Valid {
+			return nil, nil, jwt.NewValidationError("token invalid", jwt.ValidationErrorClaimsInvalid)
+		}
+		if i == 0 {
+			token, claims = t, cl
+		}
+	}
+
+	return token, claims, nil
+}
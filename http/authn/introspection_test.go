@@ -0,0 +1,146 @@
+package authn
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntrospectionParser(t *testing.T) {
+	tenantId := uuid.New()
+	var requests atomic.Int32
+	active := map[string]bool{"opaque": true, "forged": true}
+	// issuers maps tokens to the realm named in the response, defaults to the realm "test"
+	issuers := map[string]string{"forged": "other"}
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		requests.Add(1)
+		require.Equal(t, "/realms/test/protocol/openid-connect/token/introspect", request.URL.Path)
+		token := request.FormValue("token")
+
+		clientId, clientSecret, ok := request.BasicAuth()
+		if !ok || clientId != "client" || clientSecret != "secret" {
+			writer.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(writer).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+
+		realm := issuers[token]
+		if realm == "" {
+			realm = "test"
+		}
+		if !active[token] {
+			_ = json.NewEncoder(writer).Encode(map[string]any{"active": false})
+			return
+		}
+		_ = json.NewEncoder(writer).Encode(map[string]any{
+			"active":      true,
+			"iss":         "http://" + request.Host + "/realms/" + realm,
+			"sub":         "user",
+			"exp":         time.Now().Add(time.Hour).Unix(),
+			"iat":         time.Now().Unix(),
+			"tenant_id":   tenantId,
+			"tenant_name": "test",
+		})
+	}))
+	defer server.Close()
+	issuer := server.URL + "/realms/test"
+
+	t.Run("maps active tokens to claims", func(t *testing.T) {
+		parser := NewIntrospectionParser(issuer, "client", "secret", WithIntrospectionCacheTTL(0))
+
+		token, claims, err := parser.ParseToken("opaque")
+		require.NoError(t, err)
+		assert.True(t, token.Valid)
+		assert.Equal(t, "opaque", token.Raw)
+		assert.Equal(t, "user", claims.Subject)
+		assert.Equal(t, tenantId, claims.TenantId)
+	})
+
+	t.Run("rejects responses of other realms", func(t *testing.T) {
+		parser := NewIntrospectionParser(issuer, "client", "secret", WithIntrospectionCacheTTL(0))
+
+		_, _, err := parser.ParseToken("forged")
+		var validationErr *jwt.ValidationError
+		require.True(t, errors.As(err, &validationErr))
+		assert.True(t, validationErr.Is(jwt.ErrTokenInvalidIssuer))
+	})
+
+	t.Run("introspects jwts at trusted issuer", func(t *testing.T) {
+		jwtStr, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"iss": issuer}).SignedString([]byte("unknown"))
+		require.NoError(t, err)
+		active[jwtStr] = true
+
+		parser := NewIntrospectionParser("https://auth.example.com/realms/default", "client", "secret",
+			WithIntrospectionCacheTTL(0), WithIntrospectionTrustedIssuers(server.URL))
+
+		_, claims, err := parser.ParseToken(jwtStr)
+		require.NoError(t, err)
+		assert.Equal(t, issuer, claims.Issuer)
+	})
+
+	t.Run("rejects inactive tokens", func(t *testing.T) {
+		parser := NewIntrospectionParser(issuer, "client", "secret")
+
+		_, _, err := parser.ParseToken("revoked")
+		var validationErr *jwt.ValidationError
+		assert.True(t, errors.As(err, &validationErr))
+	})
+
+	t.Run("returns oauth errors", func(t *testing.T) {
+		parser := NewIntrospectionParser(issuer, "client", "wrong")
+
+		_, _, err := parser.ParseToken("opaque")
+		var oauthErr *OAuthError
+		require.True(t, errors.As(err, &oauthErr))
+		assert.Equal(t, "invalid_client", oauthErr.Code)
+	})
+
+	t.Run("caches active tokens", func(t *testing.T) {
+		parser := NewIntrospectionParser(issuer, "client", "secret")
+		requests.Store(0)
+
+		for i := 0; i < 3; i++ {
+			_, _, err := parser.ParseToken("opaque")
+			require.NoError(t, err)
+		}
+		assert.Equal(t, int32(1), requests.Load())
+	})
+}
+
+func TestTokenParserChain(t *testing.T) {
+	claims := &Claims{Name: "first"}
+	accept := parserFunc(func(tokenString string) (*jwt.Token, *Claims, error) {
+		return &jwt.Token{Valid: true}, claims, nil
+	})
+	reject := parserFunc(func(tokenString string) (*jwt.Token, *Claims, error) {
+		return nil, nil, errTokenInactive
+	})
+
+	t.Run("returns claims of the first parser", func(t *testing.T) {
+		_, parsed, err := NewTokenParserChain(accept, parserFunc(func(string) (*jwt.Token, *Claims, error) {
+			return &jwt.Token{Valid: true}, &Claims{Name: "second"}, nil
+		})).ParseToken("token")
+		require.NoError(t, err)
+		assert.Same(t, claims, parsed)
+	})
+
+	t.Run("requires all parsers to accept", func(t *testing.T) {
+		_, _, err := NewTokenParserChain(accept, reject).ParseToken("token")
+		assert.ErrorIs(t, err, errTokenInactive)
+	})
+
+	t.Run("rejects empty chains", func(t *testing.T) {
+		_, _, err := NewTokenParserChain().ParseToken("token")
+		assert.Error(t, err)
+	})
+}
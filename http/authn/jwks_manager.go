@@ -1,7 +1,12 @@
 package authn
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
 	"log"
+	"net/http"
 	"sync"
 	"time"
 
@@ -25,11 +30,50 @@ type JwksManager struct {
 	// TODO: Maybe it is a good idea to keep keyfunc.JWKS instances only for a dedicated amount of time.
 	// This may depend on the limits of this system. How many jwks instances can be created at a time without performance hits?
 	jwks map[string]*keyfunc.JWKS
+
+	// listenerLock is used to synchronize access to listeners and hashes.
+	listenerLock sync.Mutex
+	// listeners are called when the keys of a JWKS URL change.
+	listeners []func(url string)
+	// hashes are the hashes of the last JWKS responses, mapped by their URL.
+	hashes map[string][sha256.Size]byte
+
+	client *http.Client
 }
 
 func NewJwksManager() *JwksManager {
-	return &JwksManager{
-		jwks: map[string]*keyfunc.JWKS{},
+	m := &JwksManager{
+		jwks:   map[string]*keyfunc.JWKS{},
+		hashes: map[string][sha256.Size]byte{},
+	}
+	m.client = &http.Client{Transport: &jwksObserver{next: http.DefaultTransport, manager: m}}
+	return m
+}
+
+// OnKeysChanged registers a listener which is called with the JWKS URL whenever a background refresh fetches keys
+// different from the previously fetched ones.
+func (m *JwksManager) OnKeysChanged(listener func(url string)) {
+	m.listenerLock.Lock()
+	defer m.listenerLock.Unlock()
+
+	m.listeners = append(m.listeners, listener)
+}
+
+// observe records the hash of a fetched JWKS and notifies listeners if it changed.
+func (m *JwksManager) observe(url string, body []byte) {
+	hash := sha256.Sum256(body)
+
+	m.listenerLock.Lock()
+	previous, known := m.hashes[url]
+	m.hashes[url] = hash
+	listeners := m.listeners
+	m.listenerLock.Unlock()
+
+	if !known || previous == hash {
+		return
+	}
+	for _, listener := range listeners {
+		listener(url)
 	}
 }
 
@@ -43,6 +87,7 @@ func (m *JwksManager) GetKeyfuncForJwksURL(url string) (jwt.Keyfunc, error) {
 	}
 
 	kf, err := keyfunc.Get(url, keyfunc.Options{
+		Client:              m.client,
 		RefreshErrorHandler: newKeyfuncErrorHandler(url),
 		RefreshInterval:     15 * time.Minute,
 	})
@@ -54,6 +99,18 @@ func (m *JwksManager) GetKeyfuncForJwksURL(url string) (jwt.Keyfunc, error) {
 	return kf.Keyfunc, nil
 }
 
+// Prewarm fetches the JWKS of the given URLs, so that the first requests of these issuers are not delayed.
+//
+// Returns the first error encountered. JWKS which have been fetched successfully stay cached.
+func (m *JwksManager) Prewarm(urls ...string) error {
+	for _, url := range urls {
+		if _, err := m.GetKeyfuncForJwksURL(url); err != nil {
+			return fmt.Errorf("fetching JWKS from '%s' failed: %w", url, err)
+		}
+	}
+	return nil
+}
+
 func (m *JwksManager) Close() {
 	m.lock.Lock()
 	defer m.lock.Unlock()
@@ -68,3 +125,27 @@ func newKeyfuncErrorHandler(url string) func(err error) {
 		log.Printf("background refresh of JWKS for url '%s' failed: %v", url, err)
 	}
 }
+
+// jwksObserver is a http.RoundTripper passing successful JWKS responses to JwksManager.observe.
+type jwksObserver struct {
+	next    http.RoundTripper
+	manager *JwksManager
+}
+
+func (o *jwksObserver) RoundTrip(request *http.Request) (*http.Response, error) {
+	response, err := o.next.RoundTrip(request)
+	if err != nil || response.StatusCode != http.StatusOK {
+		return response, err
+	}
+
+	body, err := io.ReadAll(response.Body)
+	_ = response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	response.Body = io.NopCloser(bytes.NewReader(body))
+
+	o.manager.observe(request.URL.String(), body)
+
+	return response, nil
+}
@@ -2,6 +2,8 @@ package authn
 
 import (
 	"context"
+	"time"
+
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v4"
 )
@@ -13,10 +15,48 @@ type Jwt struct {
 	TokenStr string
 	Token    *jwt.Token
 	Claims   *Claims
+
+	// Source is the part of the request the token has been extracted from.
+	//
+	// Use this to distinguish tokens sent explicitly by clients (e.g. via the Authorization header) from tokens
+	// sent automatically by browsers (cookies), which is relevant for CSRF protection.
+	Source TokenSource
+
+	// Issuer is the issuer of the token whose keys have been used for signature validation.
+	Issuer string
+	// Realm is the Keycloak realm derived from Issuer. Empty if the issuer is not a Keycloak realm.
+	Realm string
+	// KeyId is the "kid" header of the token, identifying the key used for signature validation.
+	KeyId string
+	// ValidatedAt is the point in time the token has been validated at. For cached tokens, this is the time of the
+	// original validation, see ParseTokenValidatedAt.
+	ValidatedAt time.Time
 }
 
-func newJwt(tokenStr string, token *jwt.Token, claims *Claims) *Jwt {
-	return &Jwt{TokenStr: tokenStr, Token: token, Claims: claims}
+// NewJwt creates a Jwt from a validated token. Metadata like the issuer and key id is derived from the token and
+// ValidatedAt is set to the current time. Overwrite it with the time returned by ParseTokenValidatedAt if the token
+// may have been served from a cache.
+func NewJwt(tokenStr string, token *jwt.Token, claims *Claims, source TokenSource) *Jwt {
+	obj := &Jwt{
+		TokenStr:    tokenStr,
+		Token:       token,
+		Claims:      claims,
+		Source:      source,
+		ValidatedAt: time.Now(),
+	}
+
+	if claims != nil {
+		obj.Issuer = claims.Issuer
+		obj.Realm = KeycloakRealm(claims.Issuer)
+	}
+
+	if token != nil {
+		if kid, ok := token.Header["kid"].(string); ok {
+			obj.KeyId = kid
+		}
+	}
+
+	return obj
 }
 
 // SetCtxJwtGin sets the JWT object in the given gin context.
@@ -24,6 +64,11 @@ func SetCtxJwtGin(ctx *gin.Context, obj *Jwt) {
 	ctx.Set(ctxKeyTokenObject, obj)
 }
 
+// SetCtxJwt returns a copy of the given context holding the JWT object. Use this if you are not using gin.
+func SetCtxJwt(ctx context.Context, obj *Jwt) context.Context {
+	return context.WithValue(ctx, ctxKeyTokenObject, obj)
+}
+
 // GetCtxJwt returns the JWT object from the given context. Returns nil if no value is found.
 func GetCtxJwt(ctx context.Context) *Jwt {
 	value := ctx.Value(ctxKeyTokenObject)
@@ -1,8 +1,34 @@
 package authn
 
-import "net/http"
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
 
-// TokenExtractorChain allows you to chain multiple TokenExtractor objects together.
+// ErrTokenConflict is returned by a TokenExtractorChain using ChainPolicyErrorOnConflict if extractors yield
+// different tokens.
+var ErrTokenConflict = fmt.Errorf("%w: request carries conflicting tokens", ErrInvalidRequest)
+
+// ExtractorChainPolicy controls how a TokenExtractorChain combines the results of its extractors.
+type ExtractorChainPolicy int
+
+const (
+	// ChainPolicyFirstMatch returns the first non-empty token. The first extractor error aborts the chain.
+	ChainPolicyFirstMatch ExtractorChainPolicy = iota
+
+	// ChainPolicyErrorOnConflict runs all extractors and returns ErrTokenConflict if they yield different tokens,
+	// e.g. if the Authorization header and a cookie carry tokens of different sessions. The first extractor error
+	// aborts the chain.
+	ChainPolicyErrorOnConflict
+
+	// ChainPolicySkipOnError returns the first non-empty token but skips extractors returning an error, e.g. to fall
+	// through a broken cookie to the Authorization header. If no token is found, the first error is returned.
+	ChainPolicySkipOnError
+)
+
+// TokenExtractorChain allows you to chain multiple TokenExtractor objects together. It returns the first non-empty
+// token, see ChainPolicyFirstMatch. Use WithPolicy to select another policy.
 type TokenExtractorChain []TokenExtractor
 
 func NewTokenExtractorChain() TokenExtractorChain {
@@ -10,19 +36,81 @@ func NewTokenExtractorChain() TokenExtractorChain {
 }
 
 func (chain TokenExtractorChain) Append(extractor TokenExtractor) TokenExtractorChain {
-	return append(chain, extractor)
+	// Copy, so that chains appended to the same base do not share extractors
+	extractors := make(TokenExtractorChain, len(chain), len(chain)+1)
+	copy(extractors, chain)
+	return append(extractors, extractor)
+}
+
+// WithPolicy returns a chain of the same extractors using the given policy.
+func (chain TokenExtractorChain) WithPolicy(policy ExtractorChainPolicy) PolicyTokenExtractorChain {
+	return PolicyTokenExtractorChain{Extractors: chain, Policy: policy}
 }
 
 func (chain TokenExtractorChain) ExtractRequestToken(request *http.Request) (string, error) {
-	for _, extractor := range chain {
-		tokenStr, err := extractor.ExtractRequestToken(request)
+	tokenStr, _, err := chain.ExtractRequestTokenSource(request)
+	return tokenStr, err
+}
+
+func (chain TokenExtractorChain) ExtractRequestTokenSource(request *http.Request) (string, TokenSource, error) {
+	return chain.WithPolicy(ChainPolicyFirstMatch).ExtractRequestTokenSource(request)
+}
+
+// PolicyTokenExtractorChain is a TokenExtractorChain combining the results of its extractors according to an
+// ExtractorChainPolicy.
+type PolicyTokenExtractorChain struct {
+	Extractors TokenExtractorChain
+	Policy     ExtractorChainPolicy
+}
+
+func (chain PolicyTokenExtractorChain) ExtractRequestToken(request *http.Request) (string, error) {
+	tokenStr, _, err := chain.ExtractRequestTokenSource(request)
+	return tokenStr, err
+}
+
+func (chain PolicyTokenExtractorChain) ExtractRequestTokenSource(request *http.Request) (string, TokenSource, error) {
+	var (
+		tokenStr string
+		source   TokenSource
+		firstErr error
+	)
+
+	for _, extractor := range chain.Extractors {
+		str, src, err := ExtractRequestTokenSource(extractor, request)
+		if errors.Is(err, ErrUnsupportedScheme) {
+			// Other schemes are not meant for us, so other extractors may still yield a token
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
 		if err != nil {
-			return "", err
+			if chain.Policy != ChainPolicySkipOnError {
+				return "", TokenSourceUnknown, err
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
 		}
-		if tokenStr != "" {
-			return tokenStr, nil
+		if str == "" {
+			continue
 		}
+
+		if chain.Policy != ChainPolicyErrorOnConflict {
+			return str, src, nil
+		}
+
+		if tokenStr == "" {
+			tokenStr, source = str, src
+		} else if tokenStr != str {
+			return "", TokenSourceUnknown, ErrTokenConflict
+		}
+	}
+
+	if tokenStr == "" && firstErr != nil {
+		return "", TokenSourceUnknown, firstErr
 	}
 
-	return "", nil
+	return tokenStr, source, nil
 }
@@ -0,0 +1,150 @@
+package authn
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenExtractorChain_ExtractRequestTokenSource(t *testing.T) {
+	const cookieName = "test-at"
+
+	newChain := func(policy ExtractorChainPolicy) PolicyTokenExtractorChain {
+		return NewTokenExtractorChain().
+			Append(NewBearerHeaderTokenExtractor()).
+			Append(NewJwtCookieExtractor(cookieName, NewBase64CookieEncoder())).
+			WithPolicy(policy)
+	}
+
+	newRequest := func(headerToken, cookieValue string) *http.Request {
+		request := httptest.NewRequest("GET", "/", nil)
+		if headerToken != "" {
+			request.Header.Set("Authorization", "Bearer "+headerToken)
+		}
+		if cookieValue != "" {
+			request.AddCookie(&http.Cookie{Name: cookieName, Value: cookieValue})
+		}
+		return request
+	}
+
+	encode := func(token string) string {
+		return string(NewBase64CookieEncoder().Encode([]byte(token)))
+	}
+
+	t.Run("first match", func(t *testing.T) {
+		chain := newChain(ChainPolicyFirstMatch)
+
+		t.Run("prefers the header", func(t *testing.T) {
+			token, source, err := chain.ExtractRequestTokenSource(newRequest("header-token", encode("cookie-token")))
+			require.NoError(t, err)
+			assert.Equal(t, "header-token", token)
+			assert.Equal(t, TokenSourceHeader, source)
+		})
+
+		t.Run("falls back to the cookie", func(t *testing.T) {
+			token, source, err := chain.ExtractRequestTokenSource(newRequest("", encode("cookie-token")))
+			require.NoError(t, err)
+			assert.Equal(t, "cookie-token", token)
+			assert.Equal(t, TokenSourceCookie, source)
+		})
+
+		t.Run("skips other authorization schemes", func(t *testing.T) {
+			request := newRequest("", encode("cookie-token"))
+			request.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+
+			token, source, err := chain.ExtractRequestTokenSource(request)
+			require.NoError(t, err)
+			assert.Equal(t, "cookie-token", token)
+			assert.Equal(t, TokenSourceCookie, source)
+		})
+
+		t.Run("rejects other authorization schemes without token", func(t *testing.T) {
+			request := newRequest("", "")
+			request.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+
+			_, _, err := chain.ExtractRequestTokenSource(request)
+			assert.ErrorIs(t, err, ErrUnsupportedScheme)
+		})
+
+		t.Run("rejects malformed bearer tokens", func(t *testing.T) {
+			request := newRequest("", encode("cookie-token"))
+			request.Header.Set("Authorization", "Bearer some token")
+
+			_, _, err := chain.ExtractRequestTokenSource(request)
+			assert.ErrorIs(t, err, ErrInvalidRequest)
+		})
+
+		t.Run("aborts on broken cookie", func(t *testing.T) {
+			_, _, err := chain.ExtractRequestTokenSource(newRequest("", "not base64!"))
+			assert.Error(t, err)
+		})
+	})
+
+	t.Run("error on conflict", func(t *testing.T) {
+		chain := newChain(ChainPolicyErrorOnConflict)
+
+		t.Run("rejects different tokens", func(t *testing.T) {
+			_, _, err := chain.ExtractRequestTokenSource(newRequest("header-token", encode("cookie-token")))
+			assert.ErrorIs(t, err, ErrTokenConflict)
+			assert.ErrorIs(t, err, ErrInvalidRequest)
+		})
+
+		t.Run("accepts equal tokens", func(t *testing.T) {
+			token, source, err := chain.ExtractRequestTokenSource(newRequest("same-token", encode("same-token")))
+			require.NoError(t, err)
+			assert.Equal(t, "same-token", token)
+			assert.Equal(t, TokenSourceHeader, source)
+		})
+	})
+
+	t.Run("skip on error", func(t *testing.T) {
+		chain := NewTokenExtractorChain().
+			Append(NewJwtCookieExtractor(cookieName, NewBase64CookieEncoder())).
+			Append(NewBearerHeaderTokenExtractor()).
+			WithPolicy(ChainPolicySkipOnError)
+
+		t.Run("falls through broken cookie", func(t *testing.T) {
+			token, source, err := chain.ExtractRequestTokenSource(newRequest("header-token", "not base64!"))
+			require.NoError(t, err)
+			assert.Equal(t, "header-token", token)
+			assert.Equal(t, TokenSourceHeader, source)
+		})
+
+		t.Run("returns first error if no token is found", func(t *testing.T) {
+			_, _, err := chain.ExtractRequestTokenSource(newRequest("", "not base64!"))
+			assert.Error(t, err)
+		})
+	})
+
+	t.Run("extractor without source", func(t *testing.T) {
+		chain := NewTokenExtractorChain().Append(&mockExtractor{token: "mock-token"})
+
+		token, source, err := chain.ExtractRequestTokenSource(newRequest("", ""))
+		require.NoError(t, err)
+		assert.Equal(t, "mock-token", token)
+		assert.Equal(t, TokenSourceUnknown, source)
+	})
+
+	t.Run("append does not share extractors", func(t *testing.T) {
+		base := NewTokenExtractorChain().Append(&mockExtractor{err: errors.New("broken")})
+		_ = base.Append(&mockExtractor{token: "a"})
+		other := base.Append(&mockExtractor{token: "b"}).WithPolicy(ChainPolicySkipOnError)
+
+		token, err := other.ExtractRequestToken(newRequest("", ""))
+		require.NoError(t, err)
+		assert.Equal(t, "b", token)
+	})
+}
+
+func TestTokenExtractorChain_Slice(t *testing.T) {
+	chain := TokenExtractorChain{&mockExtractor{}}
+	chain = append(chain, &mockExtractor{token: "b"})
+
+	token, err := chain.ExtractRequestToken(httptest.NewRequest("GET", "/", nil))
+	require.NoError(t, err)
+	assert.Equal(t, "b", token)
+}
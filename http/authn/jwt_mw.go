@@ -12,10 +12,29 @@ import (
 type JwtMiddleware struct {
 	extractor TokenExtractor
 	parser    TokenParser
+	replays   ReplayStore
 }
 
-func NewJwtMiddleware(extractor TokenExtractor, parser TokenParser) *JwtMiddleware {
+// JwtMiddlewareOption configures optional behaviour of a JwtMiddleware.
+type JwtMiddlewareOption func(mw *JwtMiddleware)
+
+// WithReplayDetection makes the JwtMiddleware accept each token only once, e.g. for webhooks or signed action links.
+// Tokens must carry "jti" and "exp" claims, their ids are recorded in the given store until they expire.
+//
+// Do not use this for regular access tokens, which are sent with many requests. Tokens are parsed by the TokenParser
+// of the middleware, use a OneTimeTokenParser for tokens without tenant claims. Requests are responded with status
+// 503 if the store fails, e.g. with ErrReplayStoreFull.
+func WithReplayDetection(store ReplayStore) JwtMiddlewareOption {
+	return func(mw *JwtMiddleware) {
+		mw.replays = store
+	}
+}
+
+func NewJwtMiddleware(extractor TokenExtractor, parser TokenParser, opts ...JwtMiddlewareOption) *JwtMiddleware {
 	j := &JwtMiddleware{extractor: extractor, parser: parser}
+	for _, opt := range opts {
+		opt(j)
+	}
 	return j
 }
 
@@ -23,14 +42,20 @@ func (mw *JwtMiddleware) Gin(ctx *gin.Context) {
 	request := ctx.Request
 	writer := ctx.Writer
 
-	tokenStr, err := mw.extractor.ExtractRequestToken(request)
+	tokenStr, source, err := ExtractRequestTokenSource(mw.extractor, request)
+	if errors.Is(err, ErrInvalidRequest) {
+		writer.Header().Set("WWW-Authenticate", `Bearer error="invalid_request"`)
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		ctx.Abort()
+		return
+	}
 	if err != nil || tokenStr == "" {
 		http.Error(writer, ErrAuthTokenMissing.Error(), http.StatusUnauthorized)
 		ctx.Abort()
 		return
 	}
 
-	token, claims, err := mw.parser.ParseToken(tokenStr)
+	token, claims, validatedAt, err := ParseTokenValidatedAt(mw.parser, tokenStr)
 	if err != nil {
 		var validationErr *jwt.ValidationError
 		if errors.As(err, &validationErr) {
@@ -48,11 +73,26 @@ func (mw *JwtMiddleware) Gin(ctx *gin.Context) {
 		return
 	}
 
-	// Cache validation data so that further requests with the same token are faster.
-	// TODO: Implement token / validation caching if desired (must be configurable)
+	// Validated tokens are cached by the parser if configured, see CachingTokenParser.
+
+	// Recorded after validation, so that invalid tokens cannot use up token ids
+	if mw.replays != nil {
+		if err := checkReplay(mw.replays, claims); err != nil {
+			var validationErr *jwt.ValidationError
+			if errors.As(err, &validationErr) {
+				http.Error(writer, "auth token validation failed: "+err.Error(), http.StatusUnauthorized)
+			} else {
+				// E.g. ErrReplayStoreFull, details are not meant for clients
+				http.Error(writer, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			}
+			ctx.Abort()
+			return
+		}
+	}
 
 	// Add token to request context
 
-	obj := newJwt(tokenStr, token, claims)
+	obj := NewJwt(tokenStr, token, claims, source)
+	obj.ValidatedAt = validatedAt
 	SetCtxJwtGin(ctx, obj)
 }
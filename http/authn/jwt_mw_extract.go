@@ -2,23 +2,87 @@ package authn
 
 import (
 	"errors"
+	"fmt"
+	"mime"
 	"net/http"
+	"net/url"
 	"strings"
 )
 
-// BearerHeaderTokenExtractor extracts tokens from the Authorization header. It expects the token to be prefixed with "Bearer ".
+// AccessTokenParam is the name of the query and form parameter used to transport access tokens as defined by RFC 6750.
+const AccessTokenParam = "access_token"
+
+// BearerHeaderTokenExtractor extracts tokens from the Authorization header as described in RFC 6750 section 2.1.
+//
+// The authentication scheme is matched case-insensitively and surrounding whitespace is ignored. Requests carrying a
+// malformed bearer token or multiple Authorization headers are rejected with an error wrapping ErrInvalidRequest.
+// Requests using any other scheme than "Bearer" are rejected with ErrUnsupportedScheme, which a TokenExtractorChain
+// skips in favour of other extractors, e.g. if a proxy adds Basic credentials to cookie authenticated requests.
 type BearerHeaderTokenExtractor struct{}
 
 func NewBearerHeaderTokenExtractor() *BearerHeaderTokenExtractor {
 	return &BearerHeaderTokenExtractor{}
 }
 
+func (d *BearerHeaderTokenExtractor) TokenSource() TokenSource {
+	return TokenSourceHeader
+}
+
 func (d *BearerHeaderTokenExtractor) ExtractRequestToken(request *http.Request) (string, error) {
-	authHeader := request.Header.Get("Authorization")
-	authHeader = strings.TrimPrefix(authHeader, "bearer ")
-	authHeader = strings.TrimPrefix(authHeader, "Bearer ")
-	authHeader = strings.TrimPrefix(authHeader, "BEARER ")
-	return authHeader, nil
+	values := request.Header.Values("Authorization")
+	if len(values) == 0 {
+		return "", nil
+	}
+	if len(values) > 1 {
+		return "", fmt.Errorf("%w: multiple authorization headers", ErrInvalidRequest)
+	}
+
+	authHeader := strings.TrimSpace(values[0])
+	if authHeader == "" {
+		return "", nil
+	}
+
+	scheme, tokenStr, found := strings.Cut(authHeader, " ")
+	if !found {
+		scheme, tokenStr, found = strings.Cut(authHeader, "\t")
+	}
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", ErrUnsupportedScheme
+	}
+	if !found {
+		return "", fmt.Errorf("%w: missing bearer token", ErrInvalidRequest)
+	}
+
+	tokenStr = strings.TrimSpace(tokenStr)
+	if !isB64Token(tokenStr) {
+		return "", fmt.Errorf("%w: malformed bearer token", ErrInvalidRequest)
+	}
+
+	return tokenStr, nil
+}
+
+// isB64Token reports whether str matches the b64token syntax of RFC 6750 section 2.1.
+func isB64Token(str string) bool {
+	if str == "" {
+		return false
+	}
+
+	// Padding may only occur at the end
+	trimmed := strings.TrimRight(str, "=")
+	if trimmed == "" {
+		return false
+	}
+
+	for _, c := range trimmed {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '.', c == '_', c == '~', c == '+', c == '/':
+		default:
+			return false
+		}
+	}
+
+	return true
 }
 
 // JwtCookieExtractor extracts tokens from a cookie.
@@ -34,6 +98,10 @@ func NewJwtCookieExtractor(cookieName string, encoder CookieEncoder) *JwtCookieE
 	return &JwtCookieExtractor{cookieName: cookieName, encoder: encoder}
 }
 
+func (j *JwtCookieExtractor) TokenSource() TokenSource {
+	return TokenSourceCookie
+}
+
 func (j *JwtCookieExtractor) ExtractRequestToken(request *http.Request) (string, error) {
 	cookie, err := request.Cookie(j.cookieName)
 	if err != nil {
@@ -55,3 +123,118 @@ func (j *JwtCookieExtractor) ExtractRequestToken(request *http.Request) (string,
 
 	return string(decoded), err
 }
+
+// HeaderTokenExtractor extracts tokens from an arbitrary request header, e.g. "X-Api-Token".
+//
+// The header value is expected to be the plain token without any scheme prefix.
+type HeaderTokenExtractor struct {
+	headerName string
+}
+
+func NewHeaderTokenExtractor(headerName string) *HeaderTokenExtractor {
+	return &HeaderTokenExtractor{headerName: headerName}
+}
+
+func (h *HeaderTokenExtractor) TokenSource() TokenSource {
+	return TokenSourceHeader
+}
+
+func (h *HeaderTokenExtractor) ExtractRequestToken(request *http.Request) (string, error) {
+	return strings.TrimSpace(request.Header.Get(h.headerName)), nil
+}
+
+// QueryTokenExtractor extracts tokens from a URI query parameter as described in RFC 6750 section 2.3.
+//
+// Transporting tokens via the URI is discouraged because URIs tend to end up in logs and browser histories. Only use
+// this extractor for requests which cannot carry headers, e.g. file downloads via links or WebSocket handshakes.
+//
+// The parameter is removed from the request URL once it has been extracted, so that middlewares running
+// afterwards (e.g. request loggers) do not see the token.
+type QueryTokenExtractor struct {
+	paramName string
+}
+
+// NewQueryTokenExtractor creates a new QueryTokenExtractor.
+//
+// If paramName is empty, AccessTokenParam is used.
+func NewQueryTokenExtractor(paramName string) *QueryTokenExtractor {
+	if paramName == "" {
+		paramName = AccessTokenParam
+	}
+	return &QueryTokenExtractor{paramName: paramName}
+}
+
+func (q *QueryTokenExtractor) TokenSource() TokenSource {
+	return TokenSourceQuery
+}
+
+func (q *QueryTokenExtractor) ExtractRequestToken(request *http.Request) (string, error) {
+	if request.URL == nil || request.URL.RawQuery == "" {
+		return "", nil
+	}
+
+	// Strip the token from the URL so it is not leaked into logs. Other parameters are kept as they are, since
+	// re-encoding the query would change their order and escaping.
+	var tokenStr string
+	var found bool
+	pairs := strings.Split(request.URL.RawQuery, "&")
+	kept := pairs[:0]
+	for _, pair := range pairs {
+		key, value, _ := strings.Cut(pair, "=")
+		if key, err := url.QueryUnescape(key); err != nil || key != q.paramName {
+			kept = append(kept, pair)
+			continue
+		}
+
+		if value, err := url.QueryUnescape(value); err == nil && !found {
+			tokenStr, found = value, true
+		}
+	}
+	if len(kept) == len(pairs) {
+		return "", nil
+	}
+
+	request.URL.RawQuery = strings.Join(kept, "&")
+	request.RequestURI = request.URL.RequestURI()
+
+	return tokenStr, nil
+}
+
+// FormTokenExtractor extracts tokens from a form-encoded request body as described in RFC 6750 section 2.2.
+//
+// Only requests with content type "application/x-www-form-urlencoded" and a method other than GET are considered.
+// Note that this extractor parses the request body.
+type FormTokenExtractor struct {
+	paramName string
+}
+
+// NewFormTokenExtractor creates a new FormTokenExtractor.
+//
+// If paramName is empty, AccessTokenParam is used.
+func NewFormTokenExtractor(paramName string) *FormTokenExtractor {
+	if paramName == "" {
+		paramName = AccessTokenParam
+	}
+	return &FormTokenExtractor{paramName: paramName}
+}
+
+func (f *FormTokenExtractor) TokenSource() TokenSource {
+	return TokenSourceForm
+}
+
+func (f *FormTokenExtractor) ExtractRequestToken(request *http.Request) (string, error) {
+	if request.Method == http.MethodGet || request.Body == nil {
+		return "", nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(request.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/x-www-form-urlencoded" {
+		return "", nil
+	}
+
+	if err := request.ParseForm(); err != nil {
+		return "", err
+	}
+
+	return request.PostForm.Get(f.paramName), nil
+}
@@ -0,0 +1,173 @@
+package authn
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeaderTokenExtractor(t *testing.T) {
+	extractor := NewHeaderTokenExtractor("X-Api-Token")
+
+	t.Run("extracts token from header", func(t *testing.T) {
+		request := httptest.NewRequest("GET", "/", nil)
+		request.Header.Set("X-Api-Token", "some-token")
+
+		token, err := extractor.ExtractRequestToken(request)
+		require.NoError(t, err)
+		assert.Equal(t, "some-token", token)
+	})
+
+	t.Run("returns empty token if header is missing", func(t *testing.T) {
+		request := httptest.NewRequest("GET", "/", nil)
+
+		token, err := extractor.ExtractRequestToken(request)
+		require.NoError(t, err)
+		assert.Empty(t, token)
+	})
+}
+
+func TestQueryTokenExtractor(t *testing.T) {
+	extractor := NewQueryTokenExtractor("")
+
+	t.Run("extracts token and strips it from the url", func(t *testing.T) {
+		request := httptest.NewRequest("GET", "/download?file=a.pdf&access_token=some-token", nil)
+
+		token, err := extractor.ExtractRequestToken(request)
+		require.NoError(t, err)
+		assert.Equal(t, "some-token", token)
+		assert.Equal(t, "file=a.pdf", request.URL.RawQuery)
+		assert.Equal(t, "/download?file=a.pdf", request.RequestURI)
+	})
+
+	t.Run("keeps other parameters unchanged", func(t *testing.T) {
+		request := httptest.NewRequest("GET", "/download?z=1&access_token=some-token&a=%7e&sig=a%2Bb&a=2&access%5Ftoken=other", nil)
+
+		token, err := extractor.ExtractRequestToken(request)
+		require.NoError(t, err)
+		assert.Equal(t, "some-token", token)
+		assert.Equal(t, "z=1&a=%7e&sig=a%2Bb&a=2", request.URL.RawQuery)
+		assert.Equal(t, "/download?z=1&a=%7e&sig=a%2Bb&a=2", request.RequestURI)
+	})
+
+	t.Run("returns empty token if parameter is missing", func(t *testing.T) {
+		request := httptest.NewRequest("GET", "/download?file=a.pdf", nil)
+
+		token, err := extractor.ExtractRequestToken(request)
+		require.NoError(t, err)
+		assert.Empty(t, token)
+		assert.Equal(t, "file=a.pdf", request.URL.RawQuery)
+	})
+}
+
+func TestFormTokenExtractor(t *testing.T) {
+	extractor := NewFormTokenExtractor("")
+
+	t.Run("extracts token from form body", func(t *testing.T) {
+		request := httptest.NewRequest("POST", "/", strings.NewReader("access_token=some-token"))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		token, err := extractor.ExtractRequestToken(request)
+		require.NoError(t, err)
+		assert.Equal(t, "some-token", token)
+	})
+
+	t.Run("ignores other content types", func(t *testing.T) {
+		request := httptest.NewRequest("POST", "/", strings.NewReader(`{"access_token":"some-token"}`))
+		request.Header.Set("Content-Type", "application/json")
+
+		token, err := extractor.ExtractRequestToken(request)
+		require.NoError(t, err)
+		assert.Empty(t, token)
+	})
+
+	t.Run("ignores GET requests", func(t *testing.T) {
+		request := httptest.NewRequest("GET", "/?access_token=some-token", nil)
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		token, err := extractor.ExtractRequestToken(request)
+		require.NoError(t, err)
+		assert.Empty(t, token)
+	})
+}
+
+func TestTokenExtractorChain_Composition(t *testing.T) {
+	chain := NewTokenExtractorChain().
+		Append(NewBearerHeaderTokenExtractor()).
+		Append(NewHeaderTokenExtractor("X-Api-Token")).
+		Append(NewQueryTokenExtractor(""))
+
+	request := httptest.NewRequest("GET", "/?access_token=query-token", nil)
+
+	token, err := chain.ExtractRequestToken(request)
+	require.NoError(t, err)
+	assert.Equal(t, "query-token", token)
+}
+
+func TestBearerHeaderTokenExtractor(t *testing.T) {
+	extractor := NewBearerHeaderTokenExtractor()
+
+	t.Run("extracts token", func(t *testing.T) {
+		for _, header := range []string{
+			"Bearer some.token-value_1~+/==",
+			"bearer some.token-value_1~+/==",
+			"BeArEr some.token-value_1~+/==",
+			"  Bearer    some.token-value_1~+/==  ",
+			"Bearer\tsome.token-value_1~+/==",
+		} {
+			request := httptest.NewRequest("GET", "/", nil)
+			request.Header.Set("Authorization", header)
+
+			token, err := extractor.ExtractRequestToken(request)
+			require.NoError(t, err, header)
+			assert.Equal(t, "some.token-value_1~+/==", token, header)
+		}
+	})
+
+	t.Run("returns empty token if header is missing", func(t *testing.T) {
+		request := httptest.NewRequest("GET", "/", nil)
+
+		token, err := extractor.ExtractRequestToken(request)
+		require.NoError(t, err)
+		assert.Empty(t, token)
+	})
+
+	t.Run("rejects other schemes", func(t *testing.T) {
+		for _, header := range []string{"Basic dXNlcjpwYXNz", "Bearertoken", "some-token"} {
+			request := httptest.NewRequest("GET", "/", nil)
+			request.Header.Set("Authorization", header)
+
+			_, err := extractor.ExtractRequestToken(request)
+			assert.ErrorIs(t, err, ErrUnsupportedScheme, header)
+		}
+	})
+
+	t.Run("rejects invalid headers", func(t *testing.T) {
+		for _, header := range []string{
+			"Bearer",
+			"Bearer ",
+			"Bearertoken",
+			"Bearer some token",
+			"Bearer ==token",
+			"some-token",
+		} {
+			request := httptest.NewRequest("GET", "/", nil)
+			request.Header.Set("Authorization", header)
+
+			_, err := extractor.ExtractRequestToken(request)
+			assert.ErrorIs(t, err, ErrInvalidRequest, header)
+		}
+	})
+
+	t.Run("rejects multiple headers", func(t *testing.T) {
+		request := httptest.NewRequest("GET", "/", nil)
+		request.Header.Add("Authorization", "Bearer first")
+		request.Header.Add("Authorization", "Bearer second")
+
+		_, err := extractor.ExtractRequestToken(request)
+		assert.ErrorIs(t, err, ErrInvalidRequest)
+	})
+}
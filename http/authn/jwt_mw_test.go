@@ -41,6 +41,15 @@ func TestJwtMiddleware_Gin(t *testing.T) {
 		assert.Equal(t, 401, rec.Code)
 	})
 
+	t.Run("responds with 400 if the request is malformed", func(t *testing.T) {
+		reset()
+		extractor.err = fmt.Errorf("%w: unsupported authorization scheme", ErrInvalidRequest)
+
+		mw.Gin(ctx)
+		assert.Equal(t, 400, rec.Code)
+		assert.Equal(t, `Bearer error="invalid_request"`, rec.Header().Get("WWW-Authenticate"))
+	})
+
 	t.Run("responds with 401 if JWT parsing failed", func(t *testing.T) {
 		t.Run("with a validation error", func(t *testing.T) {
 			reset()
@@ -98,4 +107,30 @@ func TestJwtMiddleware_Gin(t *testing.T) {
 		assert.NotNil(t, ctxJwt, "context has no jwt object")
 		assert.Equal(t, parser.token, ctxJwt.Token, "jwt token is not the same as the one returned by the parser")
 	})
+
+	t.Run("records the token source and metadata", func(t *testing.T) {
+		reset()
+
+		mw = NewJwtMiddleware(NewTokenExtractorChain().Append(NewBearerHeaderTokenExtractor()), parser)
+		ctx.Request = httptest.NewRequest("GET", "/", nil)
+		ctx.Request.Header.Set("Authorization", "Bearer some-token")
+		parser.token = &jwt.Token{
+			Header: map[string]interface{}{"kid": "key-1"},
+			Valid:  true,
+		}
+		parser.claims = &Claims{
+			RegisteredClaims: jwt.RegisteredClaims{Issuer: "https://auth.dexpro.de/realms/customer"},
+		}
+
+		mw.Gin(ctx)
+		assert.Equal(t, 200, rec.Code)
+
+		ctxJwt := GetCtxJwt(ctx)
+		assert.NotNil(t, ctxJwt, "context has no jwt object")
+		assert.Equal(t, TokenSourceHeader, ctxJwt.Source)
+		assert.Equal(t, "https://auth.dexpro.de/realms/customer", ctxJwt.Issuer)
+		assert.Equal(t, "customer", ctxJwt.Realm)
+		assert.Equal(t, "key-1", ctxJwt.KeyId)
+		assert.False(t, ctxJwt.ValidatedAt.IsZero())
+	})
 }
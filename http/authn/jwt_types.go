@@ -3,6 +3,7 @@ package authn
 import (
 	"github.com/golang-jwt/jwt/v4"
 	"net/http"
+	"time"
 )
 
 type TokenExtractor interface {
@@ -12,6 +13,50 @@ type TokenExtractor interface {
 	ExtractRequestToken(request *http.Request) (string, error)
 }
 
+// TokenSource describes where on a request a token has been found.
+type TokenSource string
+
+const (
+	TokenSourceUnknown TokenSource = ""
+	TokenSourceHeader  TokenSource = "header"
+	TokenSourceCookie  TokenSource = "cookie"
+	TokenSourceQuery   TokenSource = "query"
+	TokenSourceForm    TokenSource = "form"
+)
+
+// TokenSourcer is implemented by TokenExtractor types which always extract tokens from the same TokenSource.
+type TokenSourcer interface {
+	TokenSource() TokenSource
+}
+
+// SourcedTokenExtractor is implemented by TokenExtractor types which are able to report the source of each extracted
+// token, e.g. TokenExtractorChain.
+type SourcedTokenExtractor interface {
+	TokenExtractor
+
+	// ExtractRequestTokenSource behaves like ExtractRequestToken but also returns the source of the token.
+	ExtractRequestTokenSource(request *http.Request) (string, TokenSource, error)
+}
+
+// ExtractRequestTokenSource extracts a token via the given extractor and determines its source.
+//
+// The source is TokenSourceUnknown if the extractor implements neither SourcedTokenExtractor nor TokenSourcer.
+func ExtractRequestTokenSource(extractor TokenExtractor, request *http.Request) (string, TokenSource, error) {
+	if sourced, ok := extractor.(SourcedTokenExtractor); ok {
+		return sourced.ExtractRequestTokenSource(request)
+	}
+
+	tokenStr, err := extractor.ExtractRequestToken(request)
+	if err != nil || tokenStr == "" {
+		return tokenStr, TokenSourceUnknown, err
+	}
+
+	if sourcer, ok := extractor.(TokenSourcer); ok {
+		return tokenStr, sourcer.TokenSource(), nil
+	}
+	return tokenStr, TokenSourceUnknown, nil
+}
+
 type TokenParser interface {
 	// ParseToken parses a string to a jwt.Token. Parsed Claims must also be returned. This ensures that the correct
 	// claims type is used.
@@ -19,3 +64,33 @@ type TokenParser interface {
 	// This method will either return an error or a parsed token.
 	ParseToken(tokenString string) (*jwt.Token, *Claims, error)
 }
+
+// ValidationTimeParser is implemented by TokenParsers which may return tokens validated earlier, e.g. from a
+// TokenCache.
+type ValidationTimeParser interface {
+	TokenParser
+
+	// ParseTokenValidatedAt is like ParseToken but also returns the time the token has been validated at.
+	ParseTokenValidatedAt(tokenString string) (*jwt.Token, *Claims, time.Time, error)
+}
+
+// ParseTokenValidatedAt parses the token with the given parser and returns the time it has been validated at. For
+// parsers not implementing ValidationTimeParser this is the current time.
+func ParseTokenValidatedAt(parser TokenParser, tokenString string) (*jwt.Token, *Claims, time.Time, error) {
+	if parser, ok := parser.(ValidationTimeParser); ok {
+		return parser.ParseTokenValidatedAt(tokenString)
+	}
+
+	token, claims, err := parser.ParseToken(tokenString)
+	if err != nil {
+		return nil, nil, time.Time{}, err
+	}
+	return token, claims, time.Now(), nil
+}
+
+// parserFunc adapts a function to the TokenParser interface.
+type parserFunc func(tokenString string) (*jwt.Token, *Claims, error)
+
+func (f parserFunc) ParseToken(tokenString string) (*jwt.Token, *Claims, error) {
+	return f(tokenString)
+}
@@ -3,8 +3,10 @@ package authn
 import (
 	"errors"
 	"fmt"
-	"github.com/golang-jwt/jwt/v4"
+	"net/url"
 	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
 )
 
 // NewKeycloakKeyfunc returns a keyfunc that fetches JWKS instances from a single trusted Keycloak server.
@@ -14,24 +16,28 @@ import (
 //
 // The returned keyfunc inspects the tokens "iss" (issuer) claim to determine what key set to use.
 func NewKeycloakKeyfunc(trustedIssuerBaseUrl string, jwksManager *JwksManager) jwt.Keyfunc {
+	return NewKeycloakIssuersKeyfunc([]string{trustedIssuerBaseUrl}, jwksManager)
+}
+
+// NewKeycloakIssuersKeyfunc is like NewKeycloakKeyfunc but trusts multiple Keycloak servers. Tokens are accepted if
+// their issuer starts with any of the given base URLs.
+func NewKeycloakIssuersKeyfunc(trustedIssuerBaseUrls []string, jwksManager *JwksManager) jwt.Keyfunc {
 	return func(token *jwt.Token) (interface{}, error) {
 		// Each Keycloak realm holds its own keys
 		// Therefore we must lookup the issuer to know what key to use
 
-		claims, ok := token.Claims.(*Claims)
-		if !ok {
-			return nil, errors.New("parsed token claims are not of type *Claims")
+		issuer, err := tokenIssuer(token)
+		if err != nil {
+			return nil, err
 		}
 
 		// Reject untrusted issuers
-		issuer := claims.Issuer
-		if !strings.HasPrefix(issuer, trustedIssuerBaseUrl) {
+		if !IsTrustedIssuer(issuer, trustedIssuerBaseUrls) {
 			return nil, errors.New("token has been issued by non-trusted issuer")
 		}
 
 		// Get keys
-		jwksUrl := fmt.Sprintf("%s/protocol/openid-connect/certs", issuer)
-		kf, err := jwksManager.GetKeyfuncForJwksURL(jwksUrl)
+		kf, err := jwksManager.GetKeyfuncForJwksURL(KeycloakJwksURL(issuer))
 		if err != nil {
 			return nil, err
 		}
@@ -39,3 +45,126 @@ func NewKeycloakKeyfunc(trustedIssuerBaseUrl string, jwksManager *JwksManager) j
 		return kf(token)
 	}
 }
+
+// tokenIssuer returns the "iss" claim of the given token. Tokens may be parsed into any claims type, e.g. the ID tokens
+// parsed by LoginHandler.
+func tokenIssuer(token *jwt.Token) (string, error) {
+	switch claims := token.Claims.(type) {
+	case *Claims:
+		return claims.Issuer, nil
+	case jwt.MapClaims:
+		issuer, _ := claims["iss"].(string)
+		return issuer, nil
+	}
+
+	// Decode the claims again since custom claims types do not expose the issuer
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token.Raw, claims); err != nil {
+		return "", errors.New("reading token issuer failed")
+	}
+	issuer, _ := claims["iss"].(string)
+	return issuer, nil
+}
+
+// IsTrustedIssuer reports whether the issuer belongs to any of the given trusted base URLs.
+//
+// Scheme and host (including the port) must match exactly and the path of the base URL must be a prefix of the
+// issuer path on segment boundaries, e.g. "https://auth.dexpro.de/realms" trusts "https://auth.dexpro.de/realms/x"
+// but neither "https://auth.dexpro.de.evil.com/realms/x" nor "https://auth.dexpro.de/realms-x". Issuers and base URLs
+// with user info, query, fragment, encoded or dot path segments are never trusted.
+func IsTrustedIssuer(issuer string, trustedIssuerBaseUrls []string) bool {
+	parsed, err := parseIssuerURL(issuer)
+	if err != nil {
+		return false
+	}
+
+	for _, baseUrl := range trustedIssuerBaseUrls {
+		base, err := parseIssuerURL(baseUrl)
+		if err != nil {
+			continue
+		}
+		if parsed.Scheme != base.Scheme || parsed.Host != base.Host {
+			continue
+		}
+
+		basePath := strings.TrimSuffix(base.Path, "/")
+		if parsed.Path == basePath || strings.HasPrefix(parsed.Path, basePath+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateIssuerBaseUrl returns an error if the given trusted issuer base URL can never match any issuer, see
+// IsTrustedIssuer. Use it to validate configuration.
+func ValidateIssuerBaseUrl(baseUrl string) error {
+	_, err := parseIssuerURL(baseUrl)
+	return err
+}
+
+// parseIssuerURL parses an issuer or issuer base URL. Scheme and host are normalized to lower case.
+func parseIssuerURL(str string) (*url.URL, error) {
+	parsed, err := url.Parse(str)
+	if err != nil {
+		return nil, fmt.Errorf("invalid issuer url '%s': %w", str, err)
+	}
+
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	parsed.Host = strings.ToLower(parsed.Host)
+
+	switch {
+	case parsed.Scheme != "https" && parsed.Scheme != "http":
+		return nil, fmt.Errorf("issuer url '%s' must use http or https", str)
+	case parsed.Host == "" || parsed.Opaque != "":
+		return nil, fmt.Errorf("issuer url '%s' must be absolute", str)
+	case parsed.User != nil || parsed.RawQuery != "" || parsed.ForceQuery || parsed.Fragment != "":
+		return nil, fmt.Errorf("issuer url '%s' must not contain user info, query or fragment", str)
+	case parsed.RawPath != "" || strings.Contains(parsed.Path, "\\"):
+		return nil, fmt.Errorf("issuer url '%s' must not contain encoded path characters", str)
+	}
+	for _, segment := range strings.Split(parsed.Path, "/") {
+		if segment == "." || segment == ".." {
+			return nil, fmt.Errorf("issuer url '%s' must not contain dot segments", str)
+		}
+	}
+
+	return parsed, nil
+}
+
+// KeycloakJwksURL returns the URL of the JWKS holding the keys of the given Keycloak realm issuer.
+func KeycloakJwksURL(issuer string) string {
+	return fmt.Sprintf("%s/protocol/openid-connect/certs", issuer)
+}
+
+// KeycloakAuthorizationURL returns the URL of the OIDC authorization endpoint of the given Keycloak realm issuer.
+func KeycloakAuthorizationURL(issuer string) string {
+	return fmt.Sprintf("%s/protocol/openid-connect/auth", issuer)
+}
+
+// KeycloakTokenURL returns the URL of the OIDC token endpoint of the given Keycloak realm issuer.
+func KeycloakTokenURL(issuer string) string {
+	return fmt.Sprintf("%s/protocol/openid-connect/token", issuer)
+}
+
+// KeycloakIntrospectionURL returns the URL of the OAuth 2 token introspection endpoint of the given Keycloak realm
+// issuer.
+func KeycloakIntrospectionURL(issuer string) string {
+	return fmt.Sprintf("%s/protocol/openid-connect/token/introspect", issuer)
+}
+
+// KeycloakLogoutURL returns the URL of the OIDC end session endpoint of the given Keycloak realm issuer.
+func KeycloakLogoutURL(issuer string) string {
+	return fmt.Sprintf("%s/protocol/openid-connect/logout", issuer)
+}
+
+// KeycloakRealm returns the name of the Keycloak realm that issued tokens of the given issuer, i.e. the last path
+// segment of an issuer like "https://auth.example.com/realms/<realm>".
+//
+// Returns an empty string if the issuer does not follow the Keycloak realm layout.
+func KeycloakRealm(issuer string) string {
+	_, realm, found := strings.Cut(strings.TrimSuffix(issuer, "/"), "/realms/")
+	if !found || strings.Contains(realm, "/") {
+		return ""
+	}
+	return realm
+}
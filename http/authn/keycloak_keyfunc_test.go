@@ -0,0 +1,152 @@
+package authn
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testKeycloak serves the JWKS of a Keycloak realm and signs tokens with its key.
+type testKeycloak struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+}
+
+// newTestKeycloak starts a server serving the JWKS of the realm "test". Use issuer() as "iss" claim.
+func newTestKeycloak(t *testing.T) *testKeycloak {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	keycloak := &testKeycloak{key: key}
+	keycloak.Server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path != "/realms/test/protocol/openid-connect/certs" {
+			http.NotFound(writer, request)
+			return
+		}
+		_ = json.NewEncoder(writer).Encode(map[string]any{
+			"keys": []map[string]string{{
+				"kid": "test-key",
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	}))
+	t.Cleanup(keycloak.Close)
+
+	return keycloak
+}
+
+func (k *testKeycloak) issuer() string {
+	return k.URL + "/realms/test"
+}
+
+// keyfunc returns a keyfunc created by NewKeycloakKeyfunc trusting this server.
+func (k *testKeycloak) keyfunc(t *testing.T) jwt.Keyfunc {
+	manager := NewJwksManager()
+	t.Cleanup(manager.Close)
+	return NewKeycloakKeyfunc(k.URL, manager)
+}
+
+// sign signs the given claims with the realm key.
+func (k *testKeycloak) sign(t *testing.T, claims jwt.Claims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test-key"
+	tokenStr, err := token.SignedString(k.key)
+	require.NoError(t, err)
+	return tokenStr
+}
+
+func TestNewKeycloakKeyfunc(t *testing.T) {
+	keycloak := newTestKeycloak(t)
+	keyfunc := keycloak.keyfunc(t)
+
+	registered := jwt.RegisteredClaims{
+		Issuer:    keycloak.issuer(),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+	}
+	tokenStr := keycloak.sign(t, &Claims{RegisteredClaims: registered, TenantId: uuid.New(), TenantName: "test"})
+
+	t.Run("validates claims", func(t *testing.T) {
+		token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, keyfunc)
+		require.NoError(t, err)
+		assert.True(t, token.Valid)
+	})
+
+	t.Run("validates map claims", func(t *testing.T) {
+		token, err := jwt.Parse(tokenStr, keyfunc)
+		require.NoError(t, err)
+		assert.True(t, token.Valid)
+	})
+
+	t.Run("validates custom claims", func(t *testing.T) {
+		token, err := jwt.ParseWithClaims(tokenStr, &idTokenClaims{}, keyfunc)
+		require.NoError(t, err)
+		assert.True(t, token.Valid)
+	})
+
+	t.Run("rejects untrusted issuer", func(t *testing.T) {
+		claims := registered
+		claims.Issuer = "https://evil.com/realms/test"
+
+		_, err := jwt.ParseWithClaims(keycloak.sign(t, &claims), &idTokenClaims{}, keyfunc)
+		assert.Error(t, err)
+	})
+}
+
+func TestKeycloakRealm(t *testing.T) {
+	assert.Equal(t, "customer", KeycloakRealm("https://auth.dexpro.de/realms/customer"))
+	assert.Equal(t, "customer", KeycloakRealm("https://auth.dexpro.de/auth/realms/customer/"))
+	assert.Equal(t, "", KeycloakRealm("https://portal.dexpro.de"))
+	assert.Equal(t, "", KeycloakRealm("https://auth.dexpro.de/realms/customer/protocol"))
+	assert.Equal(t, "", KeycloakRealm(""))
+}
+
+func TestIsTrustedIssuer(t *testing.T) {
+	trusted := func(issuer string, baseUrls ...string) bool {
+		return IsTrustedIssuer(issuer, baseUrls)
+	}
+
+	t.Run("matches host and path on segment boundaries", func(t *testing.T) {
+		assert.True(t, trusted("https://auth.dexpro.de/realms/x", "https://auth.dexpro.de"))
+		assert.True(t, trusted("https://auth.dexpro.de/realms/x", "https://auth.dexpro.de/"))
+		assert.True(t, trusted("https://auth.dexpro.de/realms/x", "https://auth.dexpro.de/realms/"))
+		assert.True(t, trusted("https://auth.dexpro.de/realms/x", "https://auth.dexpro.de/realms"))
+		assert.True(t, trusted("https://AUTH.dexpro.de/realms/x", "HTTPS://auth.dexpro.de/realms/"))
+		assert.True(t, trusted("https://auth.dexpro.de/realms/x", "https://other.dexpro.de", "https://auth.dexpro.de"))
+	})
+
+	t.Run("rejects lookalike issuers", func(t *testing.T) {
+		assert.False(t, trusted("https://auth.dexpro.de.evil.com/realms/x", "https://auth.dexpro.de"))
+		assert.False(t, trusted("https://auth.dexpro.de:8443/realms/x", "https://auth.dexpro.de"))
+		assert.False(t, trusted("https://auth.dexpro.de@evil.com/realms/x", "https://auth.dexpro.de"))
+		assert.False(t, trusted("http://auth.dexpro.de/realms/x", "https://auth.dexpro.de"))
+		assert.False(t, trusted("https://auth.dexpro.de/realms-evil/x", "https://auth.dexpro.de/realms"))
+		assert.False(t, trusted("https://auth.dexpro.de/realms/../evil", "https://auth.dexpro.de/realms/"))
+		assert.False(t, trusted("https://auth.dexpro.de/realms/x%2F..%2Fevil", "https://auth.dexpro.de/realms/"))
+		assert.False(t, trusted("https://auth.dexpro.de/realms/x?y", "https://auth.dexpro.de/realms/"))
+		assert.False(t, trusted("/realms/x", "https://auth.dexpro.de"))
+		assert.False(t, trusted("", "https://auth.dexpro.de"))
+	})
+
+	t.Run("ignores invalid base urls", func(t *testing.T) {
+		assert.False(t, trusted("https://auth.dexpro.de/realms/x", "auth.dexpro.de"))
+		assert.False(t, trusted("https://auth.dexpro.de/realms/x", ""))
+		assert.Error(t, ValidateIssuerBaseUrl("auth.dexpro.de"))
+		assert.NoError(t, ValidateIssuerBaseUrl("https://auth.dexpro.de/realms/"))
+	})
+}
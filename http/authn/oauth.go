@@ -0,0 +1,72 @@
+package authn
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// OAuthError is an error response of an OAuth 2 endpoint as defined in RFC 6749, section 5.2.
+type OAuthError struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int `json:"-"`
+	// Code is the error code, e.g. "invalid_grant". It is empty if the response body is no OAuth error.
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *OAuthError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("oauth request failed with status %d", e.StatusCode)
+	}
+	if e.Description == "" {
+		return fmt.Sprintf("oauth request failed with status %d: %s", e.StatusCode, e.Code)
+	}
+	return fmt.Sprintf("oauth request failed with status %d: %s (%s)", e.StatusCode, e.Code, e.Description)
+}
+
+// tokenResponse is the response of the token endpoint.
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	IdToken          string `json:"id_token"`
+	RefreshToken     string `json:"refresh_token"`
+	ExpiresIn        int    `json:"expires_in"`
+	RefreshExpiresIn int    `json:"refresh_expires_in"`
+}
+
+// requestTokens posts the given form to a token endpoint. Error responses are returned as *OAuthError.
+func requestTokens(ctx context.Context, client *http.Client, tokenURL string, form url.Values) (*tokenResponse, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("requesting tokens failed: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		oauthErr := &OAuthError{}
+		_ = json.NewDecoder(response.Body).Decode(oauthErr)
+		oauthErr.StatusCode = response.StatusCode
+		return nil, oauthErr
+	}
+
+	var tokens tokenResponse
+	if err := json.NewDecoder(response.Body).Decode(&tokens); err != nil {
+		return nil, fmt.Errorf("decoding token response failed: %w", err)
+	}
+	if tokens.AccessToken == "" {
+		return nil, errors.New("token response contains no access token")
+	}
+
+	return &tokens, nil
+}
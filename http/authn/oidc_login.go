@@ -0,0 +1,380 @@
+package authn
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	// loginStateMaxAge is the time users have to finish the login at Keycloak.
+	loginStateMaxAge = 10 * time.Minute
+
+	// defaultRedirectParam is the query parameter of the login endpoint holding the URL to return to.
+	defaultRedirectParam = "rd"
+)
+
+var (
+	errLoginStateMissing  = errors.New("missing login state")
+	errLoginStateMismatch = errors.New("login state mismatch")
+	errInvalidRedirect    = errors.New("invalid redirect url")
+)
+
+// LoginStateCookieName returns a standard cookie name to be used for cookies carrying the state of a pending login.
+func LoginStateCookieName(prefix string) string {
+	return prefix + "-login"
+}
+
+// LoginOption configures optional behaviour of a LoginHandler.
+type LoginOption func(handler *LoginHandler)
+
+// WithClientSecret sets the secret of confidential clients. Public clients rely on PKCE only.
+func WithClientSecret(secret string) LoginOption {
+	return func(handler *LoginHandler) {
+		handler.clientSecret = secret
+	}
+}
+
+// WithLoginScopes sets the scopes requested in addition to "openid".
+func WithLoginScopes(scopes ...string) LoginOption {
+	return func(handler *LoginHandler) {
+		handler.scopes = scopes
+	}
+}
+
+// WithLoginCookieEncoder sets the CookieEncoder used for all cookies written by the LoginHandler. It must match the
+// encoder of the JwtCookieExtractor reading the access token cookie. Defaults to Base64CookieEncoder.
+func WithLoginCookieEncoder(encoder CookieEncoder) LoginOption {
+	return func(handler *LoginHandler) {
+		handler.encoder = encoder
+	}
+}
+
+// WithLoginHTTPClient sets the client used to call the token endpoint. Defaults to a client with a 10s timeout.
+func WithLoginHTTPClient(client *http.Client) LoginOption {
+	return func(handler *LoginHandler) {
+		handler.client = client
+	}
+}
+
+// WithAllowedRedirectHosts allows redirects to absolute URLs of the given hosts after the login. By default, only
+// relative URLs are allowed to prevent open redirects.
+func WithAllowedRedirectHosts(hosts ...string) LoginOption {
+	return func(handler *LoginHandler) {
+		for _, host := range hosts {
+			handler.redirectHosts[strings.ToLower(host)] = struct{}{}
+		}
+	}
+}
+
+// LoginHandler implements the OIDC authorization code flow with PKCE against a Keycloak realm.
+//
+// The login endpoint redirects users to Keycloak. The callback endpoint exchanges the returned code for tokens,
+// validates the ID token and writes the access token to the cookie AccessTokenCookieName(prefix), which is read by
+// JwtCookieExtractor. Afterwards, users are redirected to the URL passed in the "rd" parameter of the login endpoint.
+//
+// Sessions can be renewed silently via refresh tokens, see WithRefreshTokenCookie and SessionGin.
+type LoginHandler struct {
+	issuer       string
+	clientId     string
+	clientSecret string
+	redirectURI  string
+	scopes       []string
+
+	cookiePrefix  string
+	encoder       CookieEncoder
+	keyfunc       jwt.Keyfunc
+	client        *http.Client
+	redirectHosts map[string]struct{}
+
+	refreshEncoder   CookieEncoder
+	refreshThreshold time.Duration
+	refreshes        refreshGroup
+
+	postLogoutRedirectURI string
+	revokers              []SessionRevoker
+
+	sessions SessionStore
+}
+
+// NewLoginHandler creates a LoginHandler for the given realm issuer and client. redirectURI must point to the
+// callback endpoint. ID tokens are verified with keyfunc, e.g. one created by NewKeycloakKeyfunc.
+func NewLoginHandler(issuer string, clientId string, redirectURI string, cookiePrefix string, keyfunc jwt.Keyfunc, opts ...LoginOption) *LoginHandler {
+	handler := &LoginHandler{
+		issuer:        strings.TrimSuffix(issuer, "/"),
+		clientId:      clientId,
+		redirectURI:   redirectURI,
+		cookiePrefix:  cookiePrefix,
+		encoder:       NewBase64CookieEncoder(),
+		keyfunc:       keyfunc,
+		client:        &http.Client{Timeout: 10 * time.Second},
+		redirectHosts: map[string]struct{}{},
+
+		refreshThreshold: defaultRefreshThreshold,
+	}
+	for _, opt := range opts {
+		opt(handler)
+	}
+	return handler
+}
+
+// RegisterGin registers the login endpoint at "/login", the callback endpoint at "/callback" and the logout
+// endpoint at "POST /logout". The back-channel logout endpoint is registered at "/backchannel-logout" if enabled.
+func (h *LoginHandler) RegisterGin(router gin.IRoutes) {
+	router.GET("/login", gin.WrapF(h.Login))
+	router.GET("/callback", gin.WrapF(h.Callback))
+	router.POST("/logout", gin.WrapF(h.Logout))
+	if len(h.revokers) > 0 {
+		router.POST("/backchannel-logout", gin.WrapF(h.BackChannelLogout))
+	}
+}
+
+// loginState is stored in a cookie between the login and the callback.
+type loginState struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	Redirect string `json:"rd"`
+}
+
+// Login redirects to the Keycloak authorization endpoint.
+func (h *LoginHandler) Login(writer http.ResponseWriter, request *http.Request) {
+	redirect := request.URL.Query().Get(defaultRedirectParam)
+	if redirect == "" {
+		redirect = "/"
+	}
+	if !h.isAllowedRedirect(redirect) {
+		http.Error(writer, errInvalidRedirect.Error(), http.StatusBadRequest)
+		return
+	}
+
+	state := loginState{Redirect: redirect}
+	for _, value := range []*string{&state.State, &state.Nonce, &state.Verifier} {
+		random, err := randomString()
+		if err != nil {
+			http.Error(writer, "generating login state failed", http.StatusInternalServerError)
+			return
+		}
+		*value = random
+	}
+
+	encoded, err := json.Marshal(state)
+	if err != nil {
+		http.Error(writer, "encoding login state failed", http.StatusInternalServerError)
+		return
+	}
+	h.setCookie(writer, LoginStateCookieName(h.cookiePrefix), string(encoded), loginStateMaxAge, h.encoder)
+
+	challenge := sha256.Sum256([]byte(state.Verifier))
+
+	query := url.Values{}
+	query.Set("client_id", h.clientId)
+	query.Set("redirect_uri", h.redirectURI)
+	query.Set("response_type", "code")
+	query.Set("scope", strings.Join(append([]string{"openid"}, h.scopes...), " "))
+	query.Set("state", state.State)
+	query.Set("nonce", state.Nonce)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+
+	http.Redirect(writer, request, KeycloakAuthorizationURL(h.issuer)+"?"+query.Encode(), http.StatusFound)
+}
+
+// Callback finishes the login and writes the access token cookie.
+func (h *LoginHandler) Callback(writer http.ResponseWriter, request *http.Request) {
+	query := request.URL.Query()
+
+	state, err := h.loginState(request)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.setCookie(writer, LoginStateCookieName(h.cookiePrefix), "", -1, nil)
+
+	if subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(state.State)) != 1 {
+		http.Error(writer, errLoginStateMismatch.Error(), http.StatusBadRequest)
+		return
+	}
+	if errCode := query.Get("error"); errCode != "" {
+		http.Error(writer, "login failed: "+errCode, http.StatusUnauthorized)
+		return
+	}
+
+	tokens, err := h.exchangeCode(request.Context(), query.Get("code"), state.Verifier)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.validateIdToken(tokens.IdToken, state.Nonce); err != nil {
+		http.Error(writer, "id token validation failed: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if h.sessions != nil {
+		if err := h.saveSession(request.Context(), writer, &Session{}, tokens); err != nil {
+			http.Error(writer, "saving session failed", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		h.setTokenCookies(writer, tokens)
+	}
+
+	http.Redirect(writer, request, state.Redirect, http.StatusFound)
+}
+
+func (h *LoginHandler) loginState(request *http.Request) (*loginState, error) {
+	cookie, err := request.Cookie(LoginStateCookieName(h.cookiePrefix))
+	if err != nil {
+		return nil, errLoginStateMissing
+	}
+
+	value, err := h.encoder.Decode([]byte(cookie.Value))
+	if err != nil {
+		return nil, errLoginStateMissing
+	}
+
+	var state loginState
+	if err := json.Unmarshal(value, &state); err != nil || state.State == "" {
+		return nil, errLoginStateMissing
+	}
+	// The cookie is not authenticated, it may have been planted by a sibling domain
+	if !h.isAllowedRedirect(state.Redirect) {
+		return nil, errInvalidRedirect
+	}
+
+	return &state, nil
+}
+
+func (h *LoginHandler) exchangeCode(ctx context.Context, code string, verifier string) (*tokenResponse, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", h.redirectURI)
+	form.Set("code_verifier", verifier)
+
+	return h.requestTokens(ctx, form)
+}
+
+// requestTokens calls the token endpoint with the given form, authenticating the client.
+func (h *LoginHandler) requestTokens(ctx context.Context, form url.Values) (*tokenResponse, error) {
+	form.Set("client_id", h.clientId)
+	if h.clientSecret != "" {
+		form.Set("client_secret", h.clientSecret)
+	}
+
+	return requestTokens(ctx, h.client, KeycloakTokenURL(h.issuer), form)
+}
+
+// idTokenClaims are the claims of an ID token relevant for validation.
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+
+	Nonce string `json:"nonce"`
+}
+
+func (h *LoginHandler) validateIdToken(tokenStr string, nonce string) error {
+	claims := &idTokenClaims{}
+	if _, err := jwt.ParseWithClaims(tokenStr, claims, h.keyfunc); err != nil {
+		return err
+	}
+
+	if claims.Issuer != h.issuer {
+		return errors.New("unexpected issuer")
+	}
+	if !claims.VerifyAudience(h.clientId, true) {
+		return errors.New("unexpected audience")
+	}
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return errors.New("nonce mismatch")
+	}
+
+	return nil
+}
+
+// setTokenCookies writes the cookies holding the tokens of the given response.
+func (h *LoginHandler) setTokenCookies(writer http.ResponseWriter, tokens *tokenResponse) {
+	h.setCookie(writer, AccessTokenCookieName(h.cookiePrefix), tokens.AccessToken, time.Duration(tokens.ExpiresIn)*time.Second, h.encoder)
+	if tokens.IdToken != "" {
+		// Kept for the browser session as hint for the logout
+		h.setCookie(writer, IdTokenCookieName(h.cookiePrefix), tokens.IdToken, 0, h.encoder)
+	}
+
+	if h.refreshEncoder != nil && tokens.RefreshToken != "" {
+		// A refresh_expires_in of zero denotes offline tokens without expiry, which are kept for the browser session
+		h.setCookie(writer, RefreshTokenCookieName(h.cookiePrefix), tokens.RefreshToken, time.Duration(tokens.RefreshExpiresIn)*time.Second, h.refreshEncoder)
+	}
+}
+
+// deleteTokenCookies deletes the cookies holding tokens.
+func (h *LoginHandler) deleteTokenCookies(writer http.ResponseWriter) {
+	h.setCookie(writer, AccessTokenCookieName(h.cookiePrefix), "", -1, nil)
+	h.setCookie(writer, IdTokenCookieName(h.cookiePrefix), "", -1, nil)
+	if h.refreshEncoder != nil {
+		h.setCookie(writer, RefreshTokenCookieName(h.cookiePrefix), "", -1, nil)
+	}
+}
+
+// setCookie writes a cookie with the value encoded by encoder. If encoder is nil, the value is written as is. A
+// negative maxAge deletes the cookie, a zero maxAge creates a session cookie.
+func (h *LoginHandler) setCookie(writer http.ResponseWriter, name string, value string, maxAge time.Duration, encoder CookieEncoder) {
+	cookie := &http.Cookie{
+		Name:     name,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(h.redirectURI, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	}
+
+	switch {
+	case maxAge < 0:
+		cookie.MaxAge = -1
+	case encoder == nil:
+		cookie.Value = value
+		cookie.MaxAge = int(maxAge.Seconds())
+	default:
+		cookie.Value = string(encoder.Encode([]byte(value)))
+		cookie.MaxAge = int(maxAge.Seconds())
+	}
+
+	http.SetCookie(writer, cookie)
+}
+
+// isAllowedRedirect reports whether users may be redirected to the given URL after the login.
+func (h *LoginHandler) isAllowedRedirect(redirect string) bool {
+	parsed, err := url.Parse(redirect)
+	if err != nil {
+		return false
+	}
+
+	if !parsed.IsAbs() && parsed.Host == "" {
+		// Reject scheme relative URLs like "//evil.com" and backslash tricks
+		return strings.HasPrefix(redirect, "/") && !strings.HasPrefix(redirect, "//") && !strings.Contains(redirect, "\\")
+	}
+
+	if parsed.Scheme != "https" && parsed.Scheme != "http" {
+		return false
+	}
+	_, ok := h.redirectHosts[strings.ToLower(parsed.Host)]
+	return ok
+}
+
+// randomString returns a random base64url encoded string of 32 bytes.
+func randomString() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
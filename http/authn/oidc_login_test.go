@@ -0,0 +1,181 @@
+package authn
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoginHandler(t *testing.T) {
+	key := []byte("test-signing-key")
+	keyfunc := func(token *jwt.Token) (interface{}, error) {
+		return key, nil
+	}
+
+	var challenge, nonce string
+	keycloak := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		require.Equal(t, "/realms/test/protocol/openid-connect/token", request.URL.Path)
+		require.NoError(t, request.ParseForm())
+
+		verifier := sha256.Sum256([]byte(request.PostForm.Get("code_verifier")))
+		if request.PostForm.Get("code") != "test-code" || base64.RawURLEncoding.EncodeToString(verifier[:]) != challenge {
+			http.Error(writer, "invalid_grant", http.StatusBadRequest)
+			return
+		}
+
+		idToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &idTokenClaims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    "http://" + request.Host + "/realms/test",
+				Audience:  jwt.ClaimStrings{"web"},
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			},
+			Nonce: nonce,
+		}).SignedString(key)
+		require.NoError(t, err)
+
+		_ = json.NewEncoder(writer).Encode(map[string]any{
+			"access_token": "test-access-token",
+			"id_token":     idToken,
+			"expires_in":   300,
+		})
+	}))
+	defer keycloak.Close()
+
+	handler := NewLoginHandler(keycloak.URL+"/realms/test", "web", "https://app.example.com/callback", "dexp", keyfunc)
+
+	login := func(t *testing.T, target string) (*http.Cookie, url.Values) {
+		rec := httptest.NewRecorder()
+		handler.Login(rec, httptest.NewRequest("GET", target, nil))
+		require.Equal(t, 302, rec.Code)
+
+		location, err := url.Parse(rec.Header().Get("Location"))
+		require.NoError(t, err)
+		assert.Equal(t, "/realms/test/protocol/openid-connect/auth", location.Path)
+
+		cookies := rec.Result().Cookies()
+		require.Len(t, cookies, 1)
+		assert.Equal(t, "dexp-login", cookies[0].Name)
+		assert.True(t, cookies[0].HttpOnly)
+		assert.True(t, cookies[0].Secure)
+
+		query := location.Query()
+		challenge, nonce = query.Get("code_challenge"), query.Get("nonce")
+		return cookies[0], query
+	}
+
+	callback := func(cookie *http.Cookie, query string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("GET", "/callback?"+query, nil)
+		if cookie != nil {
+			request.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		handler.Callback(rec, request)
+		return rec
+	}
+
+	t.Run("redirects to authorization endpoint", func(t *testing.T) {
+		_, query := login(t, "/login?rd=/items")
+		assert.Equal(t, "web", query.Get("client_id"))
+		assert.Equal(t, "code", query.Get("response_type"))
+		assert.Equal(t, "openid", query.Get("scope"))
+		assert.Equal(t, "S256", query.Get("code_challenge_method"))
+		assert.NotEmpty(t, query.Get("state"))
+		assert.NotEmpty(t, query.Get("nonce"))
+	})
+
+	t.Run("rejects open redirects", func(t *testing.T) {
+		for _, target := range []string{"https://evil.com/", "//evil.com/", "/\\evil.com", "javascript:alert(1)"} {
+			rec := httptest.NewRecorder()
+			handler.Login(rec, httptest.NewRequest("GET", "/login?rd="+url.QueryEscape(target), nil))
+			assert.Equal(t, 400, rec.Code, target)
+		}
+	})
+
+	t.Run("sets access token cookie", func(t *testing.T) {
+		cookie, query := login(t, "/login?rd=/items")
+
+		rec := callback(cookie, "code=test-code&state="+query.Get("state"))
+		require.Equal(t, 302, rec.Code, rec.Body.String())
+		assert.Equal(t, "/items", rec.Header().Get("Location"))
+
+		request := httptest.NewRequest("GET", "/items", nil)
+		for _, c := range rec.Result().Cookies() {
+			if c.MaxAge >= 0 {
+				request.AddCookie(c)
+			}
+		}
+		token, err := NewJwtCookieExtractor(AccessTokenCookieName("dexp"), NewBase64CookieEncoder()).ExtractRequestToken(request)
+		require.NoError(t, err)
+		assert.Equal(t, "test-access-token", token)
+	})
+
+	t.Run("rejects state mismatch", func(t *testing.T) {
+		cookie, _ := login(t, "/login")
+		assert.Equal(t, 400, callback(cookie, "code=test-code&state=other").Code)
+	})
+
+	t.Run("rejects missing login state", func(t *testing.T) {
+		_, query := login(t, "/login")
+		assert.Equal(t, 400, callback(nil, "code=test-code&state="+query.Get("state")).Code)
+	})
+
+	t.Run("rejects planted redirects", func(t *testing.T) {
+		state, err := json.Marshal(loginState{State: "planted", Nonce: "nonce", Verifier: "verifier", Redirect: "https://evil.com/"})
+		require.NoError(t, err)
+		cookie := &http.Cookie{Name: "dexp-login", Value: string(NewBase64CookieEncoder().Encode(state))}
+
+		rec := callback(cookie, "code=test-code&state=planted")
+		assert.Equal(t, 400, rec.Code)
+		assert.Empty(t, rec.Header().Get("Location"))
+	})
+
+	t.Run("rejects nonce mismatch", func(t *testing.T) {
+		cookie, query := login(t, "/login")
+		nonce = "other"
+		assert.Equal(t, 401, callback(cookie, "code=test-code&state="+query.Get("state")).Code)
+	})
+
+	t.Run("rejects invalid code", func(t *testing.T) {
+		cookie, query := login(t, "/login")
+		assert.Equal(t, 401, callback(cookie, "code=other&state="+query.Get("state")).Code)
+	})
+}
+
+func TestLoginHandler_KeycloakKeyfunc(t *testing.T) {
+	keycloak := newTestKeycloak(t)
+	handler := NewLoginHandler(keycloak.issuer(), "web", "https://app.example.com/callback", "dexp", keycloak.keyfunc(t))
+
+	idToken := keycloak.sign(t, &idTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    keycloak.issuer(),
+			Audience:  jwt.ClaimStrings{"web"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+		Nonce: "test-nonce",
+	})
+
+	t.Run("validates id tokens", func(t *testing.T) {
+		assert.NoError(t, handler.validateIdToken(idToken, "test-nonce"))
+	})
+
+	t.Run("rejects id tokens of other keys", func(t *testing.T) {
+		other := newTestKeycloak(t)
+		assert.Error(t, handler.validateIdToken(other.sign(t, &idTokenClaims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    keycloak.issuer(),
+				Audience:  jwt.ClaimStrings{"web"},
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			},
+			Nonce: "test-nonce",
+		}), "test-nonce"))
+	})
+}
@@ -0,0 +1,131 @@
+package authn
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// backChannelLogoutEvent is the event identifying logout tokens, see OpenID Connect Back-Channel Logout 1.0.
+const backChannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+// WithPostLogoutRedirectURI sets the URL Keycloak redirects users to after logging out. It must be registered as
+// valid post logout redirect URI of the client.
+func WithPostLogoutRedirectURI(uri string) LoginOption {
+	return func(handler *LoginHandler) {
+		handler.postLogoutRedirectURI = uri
+	}
+}
+
+// WithBackChannelLogout enables the back-channel logout endpoint. Sessions ended at Keycloak are revoked in the
+// given revokers, e.g. the MemoryRevocationStore used by the AuthStack of the service.
+func WithBackChannelLogout(revokers ...SessionRevoker) LoginOption {
+	return func(handler *LoginHandler) {
+		handler.revokers = append(handler.revokers, revokers...)
+	}
+}
+
+// Logout deletes the token cookies and redirects to the Keycloak end session endpoint, passing the ID token of the
+// login as hint.
+//
+// Only POST requests are accepted, so that other sites cannot log users out via links or images. Use CsrfProtection
+// to protect against cross-site form submissions as well.
+func (h *LoginHandler) Logout(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		writer.Header().Set("Allow", http.MethodPost)
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := url.Values{}
+	query.Set("client_id", h.clientId)
+	if h.postLogoutRedirectURI != "" {
+		query.Set("post_logout_redirect_uri", h.postLogoutRedirectURI)
+	}
+
+	var idToken string
+	if h.sessions != nil {
+		idToken = h.deleteStoredSession(writer, request)
+	} else {
+		if cookie, err := request.Cookie(IdTokenCookieName(h.cookiePrefix)); err == nil {
+			if decoded, err := h.encoder.Decode([]byte(cookie.Value)); err == nil {
+				idToken = string(decoded)
+			}
+		}
+		h.deleteTokenCookies(writer)
+	}
+	if idToken != "" {
+		query.Set("id_token_hint", idToken)
+	}
+
+	http.Redirect(writer, request, KeycloakLogoutURL(h.issuer)+"?"+query.Encode(), http.StatusFound)
+}
+
+// logoutTokenClaims are the claims of a back-channel logout token.
+type logoutTokenClaims struct {
+	jwt.RegisteredClaims
+
+	SessionId string                     `json:"sid"`
+	Events    map[string]json.RawMessage `json:"events"`
+	Nonce     *string                    `json:"nonce"`
+}
+
+// BackChannelLogout receives logout tokens sent by Keycloak when sessions end and revokes these sessions.
+func (h *LoginHandler) BackChannelLogout(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Cache-Control", "no-store")
+
+	if request.Method != http.MethodPost {
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, err := h.parseLogoutToken(request.PostFormValue("logout_token"))
+	if err != nil {
+		http.Error(writer, "invalid logout token: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for _, revoker := range h.revokers {
+		if err := revoker.RevokeSession(claims.Issuer, claims.SessionId, claims.Subject); err != nil {
+			http.Error(writer, "revoking session failed", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	writer.WriteHeader(http.StatusOK)
+}
+
+func (h *LoginHandler) parseLogoutToken(tokenStr string) (*logoutTokenClaims, error) {
+	if tokenStr == "" {
+		return nil, errors.New("missing logout token")
+	}
+
+	claims := &logoutTokenClaims{}
+	if _, err := jwt.ParseWithClaims(tokenStr, claims, h.keyfunc); err != nil {
+		return nil, err
+	}
+
+	if claims.Issuer != h.issuer {
+		return nil, errors.New("unexpected issuer")
+	}
+	if !claims.VerifyAudience(h.clientId, true) {
+		return nil, errors.New("unexpected audience")
+	}
+	if claims.IssuedAt == nil {
+		return nil, errMissingIatClaim
+	}
+	if _, ok := claims.Events[backChannelLogoutEvent]; !ok {
+		return nil, errors.New("missing logout event")
+	}
+	if claims.SessionId == "" && claims.Subject == "" {
+		return nil, errors.New("missing sid and sub claims")
+	}
+	if claims.Nonce != nil {
+		return nil, errors.New("logout tokens must not contain a nonce")
+	}
+
+	return claims, nil
+}
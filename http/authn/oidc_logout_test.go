@@ -0,0 +1,153 @@
+package authn
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoginHandler_Logout(t *testing.T) {
+	handler := NewLoginHandler("https://auth.example.com/realms/test", "web", "https://app.example.com/callback", "dexp", nil,
+		WithPostLogoutRedirectURI("https://app.example.com/"))
+
+	t.Run("rejects get requests", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.Logout(rec, httptest.NewRequest("GET", "/logout", nil))
+		assert.Equal(t, 405, rec.Code)
+		assert.Empty(t, rec.Result().Cookies())
+	})
+
+	request := httptest.NewRequest("POST", "/logout", nil)
+	request.AddCookie(&http.Cookie{Name: "dexp-id", Value: string(NewBase64CookieEncoder().Encode([]byte("test-id-token")))})
+	rec := httptest.NewRecorder()
+	handler.Logout(rec, request)
+
+	require.Equal(t, 302, rec.Code)
+	location, err := url.Parse(rec.Header().Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, "/realms/test/protocol/openid-connect/logout", location.Path)
+	assert.Equal(t, "test-id-token", location.Query().Get("id_token_hint"))
+	assert.Equal(t, "https://app.example.com/", location.Query().Get("post_logout_redirect_uri"))
+
+	deleted := map[string]bool{}
+	for _, cookie := range rec.Result().Cookies() {
+		deleted[cookie.Name] = cookie.MaxAge < 0
+	}
+	assert.Equal(t, map[string]bool{"dexp-at": true, "dexp-id": true}, deleted)
+}
+
+func TestLoginHandler_BackChannelLogout(t *testing.T) {
+	const issuer = "https://auth.example.com/realms/test"
+	key := []byte("test-signing-key")
+	keyfunc := func(token *jwt.Token) (interface{}, error) {
+		return key, nil
+	}
+
+	revocations := NewMemoryRevocationStore(0)
+	handler := NewLoginHandler(issuer, "web", "https://app.example.com/callback", "dexp", keyfunc,
+		WithBackChannelLogout(revocations))
+
+	newLogoutToken := func(modify func(claims jwt.MapClaims)) string {
+		claims := jwt.MapClaims{
+			"iss":    issuer,
+			"aud":    "web",
+			"iat":    time.Now().Unix(),
+			"exp":    time.Now().Add(time.Minute).Unix(),
+			"sub":    "test-user",
+			"sid":    "test-session",
+			"events": map[string]any{backChannelLogoutEvent: map[string]any{}},
+		}
+		if modify != nil {
+			modify(claims)
+		}
+		tokenStr, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+		require.NoError(t, err)
+		return tokenStr
+	}
+
+	logout := func(logoutToken string) int {
+		request := httptest.NewRequest("POST", "/backchannel-logout", strings.NewReader(url.Values{"logout_token": {logoutToken}}.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		handler.BackChannelLogout(rec, request)
+		return rec.Code
+	}
+
+	newAccessToken := func(sessionId string) string {
+		tokenStr, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    issuer,
+				Subject:   "test-user",
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+				IssuedAt:  jwt.NewNumericDate(time.Now().Add(-time.Minute)),
+			},
+			TenantId:   uuid.New(),
+			TenantName: "test",
+			SessionId:  sessionId,
+		}).SignedString(key)
+		require.NoError(t, err)
+		return tokenStr
+	}
+
+	t.Run("rejects invalid logout tokens", func(t *testing.T) {
+		assert.Equal(t, 400, logout(""))
+		assert.Equal(t, 400, logout(newLogoutToken(func(claims jwt.MapClaims) { claims["aud"] = "other" })))
+		assert.Equal(t, 400, logout(newLogoutToken(func(claims jwt.MapClaims) { claims["iss"] = "https://evil.com" })))
+		assert.Equal(t, 400, logout(newLogoutToken(func(claims jwt.MapClaims) { delete(claims, "events") })))
+		assert.Equal(t, 400, logout(newLogoutToken(func(claims jwt.MapClaims) { claims["nonce"] = "abc" })))
+		assert.Equal(t, 400, logout(newLogoutToken(func(claims jwt.MapClaims) {
+			delete(claims, "sid")
+			delete(claims, "sub")
+		})))
+	})
+
+	t.Run("revokes sessions", func(t *testing.T) {
+		stack := NewAuthStack(NewTokenExtractorChain(), keyfunc, WithRevocations(revocations), WithTokenCache(NewTokenCache()))
+
+		tokenStr := newAccessToken("test-session")
+		_, _, err := stack.ParseToken(tokenStr)
+		require.NoError(t, err)
+
+		require.Equal(t, 200, logout(newLogoutToken(nil)))
+
+		_, _, err = stack.ParseToken(tokenStr)
+		var validationErr *jwt.ValidationError
+		assert.ErrorAs(t, err, &validationErr)
+
+		_, _, err = stack.ParseToken(newAccessToken("other-session"))
+		assert.NoError(t, err)
+	})
+}
+
+func TestLoginHandler_ParseLogoutToken_KeycloakKeyfunc(t *testing.T) {
+	keycloak := newTestKeycloak(t)
+	handler := NewLoginHandler(keycloak.issuer(), "web", "https://app.example.com/callback", "dexp", keycloak.keyfunc(t))
+
+	claims, err := handler.parseLogoutToken(keycloak.sign(t, jwt.MapClaims{
+		"iss":    keycloak.issuer(),
+		"aud":    "web",
+		"iat":    time.Now().Unix(),
+		"exp":    time.Now().Add(time.Minute).Unix(),
+		"sid":    "test-session",
+		"events": map[string]any{backChannelLogoutEvent: map[string]any{}},
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, "test-session", claims.SessionId)
+
+	_, err = handler.parseLogoutToken(keycloak.sign(t, jwt.MapClaims{
+		"iss":    "https://evil.com/realms/test",
+		"aud":    "web",
+		"iat":    time.Now().Unix(),
+		"sid":    "test-session",
+		"events": map[string]any{backChannelLogoutEvent: map[string]any{}},
+	}))
+	assert.Error(t, err)
+}
@@ -0,0 +1,122 @@
+package authn
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// WithSessionStore makes the LoginHandler keep tokens in the given SessionStore. Clients only receive the session id
+// in the cookie SessionCookieName(prefix), which is resolved by SessionTokenExtractor.
+//
+// Sessions are renewed via refresh tokens, see LoginHandler.SessionGin, and deleted on back-channel logout.
+func WithSessionStore(store SessionStore) LoginOption {
+	return func(handler *LoginHandler) {
+		handler.sessions = store
+		handler.revokers = append(handler.revokers, store)
+	}
+}
+
+// saveSession stores the given tokens in the session and writes the session cookie. A new session id is generated
+// for sessions without id.
+func (h *LoginHandler) saveSession(ctx context.Context, writer http.ResponseWriter, session *Session, tokens *tokenResponse) error {
+	if session.Id == "" {
+		id, err := randomString()
+		if err != nil {
+			return err
+		}
+		session.Id = id
+	}
+
+	claims := &Claims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(tokens.AccessToken, claims); err != nil {
+		return err
+	}
+	session.Issuer = claims.Issuer
+	session.Subject = claims.Subject
+	session.KeycloakSessionId = claims.SessionId
+
+	session.AccessToken = tokens.AccessToken
+	if tokens.RefreshToken != "" {
+		session.RefreshToken = tokens.RefreshToken
+	}
+	if tokens.IdToken != "" {
+		session.IdToken = tokens.IdToken
+	}
+
+	// Sessions end with the refresh token or, without refresh token, with the access token
+	var maxAge time.Duration
+	switch {
+	case session.RefreshToken == "":
+		maxAge = time.Duration(tokens.ExpiresIn) * time.Second
+	case tokens.RefreshExpiresIn > 0:
+		maxAge = time.Duration(tokens.RefreshExpiresIn) * time.Second
+	}
+	session.ExpiresAt = time.Time{}
+	if maxAge > 0 {
+		session.ExpiresAt = time.Now().Add(maxAge)
+	}
+
+	if err := h.sessions.Save(ctx, session); err != nil {
+		return err
+	}
+
+	h.setCookie(writer, SessionCookieName(h.cookiePrefix), session.Id, maxAge, nil)
+	return nil
+}
+
+// renewStoredSession refreshes the tokens of the stored session of the request, see RenewSession.
+func (h *LoginHandler) renewStoredSession(writer http.ResponseWriter, request *http.Request) error {
+	cookie, err := request.Cookie(SessionCookieName(h.cookiePrefix))
+	if err != nil {
+		return nil
+	}
+
+	session, err := h.sessions.Get(request.Context(), cookie.Value)
+	if errors.Is(err, ErrSessionNotFound) {
+		h.setCookie(writer, SessionCookieName(h.cookiePrefix), "", -1, nil)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if session.RefreshToken == "" || !h.expiresSoon(session.AccessToken) {
+		return nil
+	}
+
+	tokens, err := h.refreshes.do(session.RefreshToken, func() (*tokenResponse, error) {
+		return h.refreshTokens(request.Context(), session.RefreshToken)
+	})
+	if err != nil {
+		var oauthErr *OAuthError
+		if errors.As(err, &oauthErr) && oauthErr.Code == "invalid_grant" {
+			_ = h.sessions.Delete(request.Context(), session.Id)
+			h.setCookie(writer, SessionCookieName(h.cookiePrefix), "", -1, nil)
+		}
+		return err
+	}
+
+	return h.saveSession(request.Context(), writer, session, tokens)
+}
+
+// deleteStoredSession deletes the stored session of the request and its cookie. Returns the ID token of the session
+// if known.
+func (h *LoginHandler) deleteStoredSession(writer http.ResponseWriter, request *http.Request) string {
+	h.setCookie(writer, SessionCookieName(h.cookiePrefix), "", -1, nil)
+
+	cookie, err := request.Cookie(SessionCookieName(h.cookiePrefix))
+	if err != nil {
+		return ""
+	}
+
+	session, err := h.sessions.Get(request.Context(), cookie.Value)
+	_ = h.sessions.Delete(request.Context(), cookie.Value)
+	if err != nil {
+		return ""
+	}
+	return session.IdToken
+}
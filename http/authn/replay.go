@@ -0,0 +1,134 @@
+package authn
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const defaultReplayStoreMaxSize = 100000
+
+var (
+	ErrTokenReplayed   = jwt.NewValidationError("token has already been used", jwt.ValidationErrorId)
+	ErrReplayStoreFull = errors.New("replay store is full")
+
+	errMissingJtiClaim   = jwt.NewValidationError("one-time tokens require a jti claim", jwt.ValidationErrorId)
+	errMissingExpOneTime = jwt.NewValidationError("one-time tokens require an exp claim", jwt.ValidationErrorExpired)
+)
+
+// ReplayStore records the ids of used one-time tokens. See WithReplayDetection.
+type ReplayStore interface {
+	// Use records the token id of the given issuer until expiresAt. Returns ErrTokenReplayed if the id has already
+	// been recorded.
+	Use(issuer string, tokenId string, expiresAt time.Time) error
+}
+
+type replayKey struct {
+	issuer  string
+	tokenId string
+}
+
+// MemoryReplayStore is a ReplayStore keeping token ids in memory. Ids are not shared between instances of a
+// service, so one-time tokens must always be sent to the same instance.
+//
+// The store is bounded: expired ids are pruned when the store is full and ErrReplayStoreFull is returned if there is
+// still no space. Unexpired ids are never evicted, since this would allow replaying their tokens.
+type MemoryReplayStore struct {
+	maxSize int
+	now     func() time.Time
+
+	lock sync.Mutex
+	used map[replayKey]time.Time
+}
+
+// NewMemoryReplayStore creates a MemoryReplayStore holding up to maxSize ids. If maxSize is zero, a default of
+// 100000 is used.
+func NewMemoryReplayStore(maxSize int) *MemoryReplayStore {
+	if maxSize == 0 {
+		maxSize = defaultReplayStoreMaxSize
+	}
+	return &MemoryReplayStore{maxSize: maxSize, now: time.Now, used: map[replayKey]time.Time{}}
+}
+
+func (s *MemoryReplayStore) Use(issuer string, tokenId string, expiresAt time.Time) error {
+	now := s.now()
+	key := replayKey{issuer: issuer, tokenId: tokenId}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if usedUntil, ok := s.used[key]; ok && now.Before(usedUntil) {
+		return ErrTokenReplayed
+	}
+
+	if len(s.used) >= s.maxSize {
+		s.prune(now)
+		if len(s.used) >= s.maxSize {
+			return ErrReplayStoreFull
+		}
+	}
+
+	s.used[key] = expiresAt
+	return nil
+}
+
+// prune removes ids of expired tokens. Must be called with the lock held.
+func (s *MemoryReplayStore) prune(now time.Time) {
+	for key, usedUntil := range s.used {
+		if !now.Before(usedUntil) {
+			delete(s.used, key)
+		}
+	}
+}
+
+// oneTimeClaims are Claims of one-time tokens, which only need valid registered claims.
+type oneTimeClaims struct {
+	Claims
+}
+
+func (c *oneTimeClaims) Valid() error {
+	if err := c.RegisteredClaims.Valid(); err != nil {
+		return err
+	}
+	if c.ID == "" {
+		return errMissingJtiClaim
+	}
+	if c.ExpiresAt == nil {
+		return errMissingExpOneTime
+	}
+	return nil
+}
+
+// OneTimeTokenParser is a TokenParser for one-time tokens, see WithReplayDetection. It verifies the signature and the
+// registered claims and requires "jti" and "exp" claims. Unlike access tokens, no tenant claims are required.
+type OneTimeTokenParser struct {
+	keyfunc jwt.Keyfunc
+}
+
+// NewOneTimeTokenParser creates a OneTimeTokenParser verifying signatures with the given keyfunc, e.g. one created by
+// NewKeycloakKeyfunc.
+func NewOneTimeTokenParser(keyfunc jwt.Keyfunc) *OneTimeTokenParser {
+	return &OneTimeTokenParser{keyfunc: keyfunc}
+}
+
+func (p *OneTimeTokenParser) ParseToken(tokenString string) (*jwt.Token, *Claims, error) {
+	claims := &oneTimeClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, p.keyfunc)
+	if err != nil {
+		return nil, nil, err
+	}
+	return token, &claims.Claims, nil
+}
+
+// checkReplay records the token of the given claims in the store and fails if it has been used before.
+func checkReplay(store ReplayStore, claims *Claims) error {
+	if claims.ID == "" {
+		return errMissingJtiClaim
+	}
+	if claims.ExpiresAt == nil {
+		return errMissingExpOneTime
+	}
+	return store.Use(claims.Issuer, claims.ID, claims.ExpiresAt.Time)
+}
@@ -0,0 +1,137 @@
+package authn
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryReplayStore(t *testing.T) {
+	now := time.Now()
+	newStore := func(maxSize int) *MemoryReplayStore {
+		store := NewMemoryReplayStore(maxSize)
+		store.now = func() time.Time { return now }
+		return store
+	}
+
+	t.Run("rejects reuse until expiry", func(t *testing.T) {
+		store := newStore(0)
+		require.NoError(t, store.Use("iss", "jti", now.Add(time.Minute)))
+		assert.ErrorIs(t, store.Use("iss", "jti", now.Add(time.Minute)), ErrTokenReplayed)
+		assert.NoError(t, store.Use("other", "jti", now.Add(time.Minute)))
+
+		now = now.Add(time.Minute)
+		assert.NoError(t, store.Use("iss", "jti", now.Add(time.Minute)))
+	})
+
+	t.Run("prunes expired ids when full", func(t *testing.T) {
+		store := newStore(2)
+		require.NoError(t, store.Use("iss", "a", now.Add(time.Second)))
+		require.NoError(t, store.Use("iss", "b", now.Add(time.Minute)))
+		assert.ErrorIs(t, store.Use("iss", "c", now.Add(time.Minute)), ErrReplayStoreFull)
+
+		now = now.Add(time.Second)
+		assert.NoError(t, store.Use("iss", "c", now.Add(time.Minute)))
+		assert.ErrorIs(t, store.Use("iss", "b", now.Add(time.Minute)), ErrTokenReplayed)
+	})
+}
+
+func TestJwtMiddleware_ReplayDetection(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+
+	serve := func(mw *JwtMiddleware) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		ctx := gin.CreateTestContextOnly(rec, engine)
+		ctx.Request = httptest.NewRequest("POST", "/webhook", nil)
+		mw.Gin(ctx)
+		return rec
+	}
+	newParser := func(id string) *mockParser {
+		claims := &Claims{RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "iss",
+			ID:        id,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		}}
+		return &mockParser{token: &jwt.Token{Valid: true, Claims: claims}, claims: claims}
+	}
+
+	t.Run("accepts tokens only once", func(t *testing.T) {
+		mw := NewJwtMiddleware(&mockExtractor{token: "token"}, newParser("jti"), WithReplayDetection(NewMemoryReplayStore(0)))
+
+		assert.Equal(t, 200, serve(mw).Code)
+		assert.Equal(t, 401, serve(mw).Code)
+	})
+
+	t.Run("rejects tokens without jti", func(t *testing.T) {
+		mw := NewJwtMiddleware(&mockExtractor{token: "token"}, newParser(""), WithReplayDetection(NewMemoryReplayStore(0)))
+
+		assert.Equal(t, 401, serve(mw).Code)
+	})
+
+	t.Run("rejects tokens without exp", func(t *testing.T) {
+		parser := newParser("jti")
+		parser.claims.ExpiresAt = nil
+		mw := NewJwtMiddleware(&mockExtractor{token: "token"}, parser, WithReplayDetection(NewMemoryReplayStore(0)))
+
+		assert.Equal(t, 401, serve(mw).Code)
+	})
+
+	t.Run("responds with 503 if the store is full", func(t *testing.T) {
+		store := NewMemoryReplayStore(1)
+		require.NoError(t, store.Use("iss", "other", time.Now().Add(time.Minute)))
+		mw := NewJwtMiddleware(&mockExtractor{token: "token"}, newParser("jti"), WithReplayDetection(store))
+
+		rec := serve(mw)
+		assert.Equal(t, 503, rec.Code)
+		assert.NotContains(t, rec.Body.String(), ErrReplayStoreFull.Error())
+	})
+}
+
+func TestOneTimeTokenParser(t *testing.T) {
+	key := []byte("test-signing-key")
+	parser := NewOneTimeTokenParser(func(token *jwt.Token) (interface{}, error) {
+		return key, nil
+	})
+	sign := func(claims jwt.RegisteredClaims) string {
+		tokenStr, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+		require.NoError(t, err)
+		return tokenStr
+	}
+	exp := jwt.NewNumericDate(time.Now().Add(time.Minute))
+
+	t.Run("accepts tokens without tenant claims", func(t *testing.T) {
+		token, claims, err := parser.ParseToken(sign(jwt.RegisteredClaims{Issuer: "iss", ID: "jti", ExpiresAt: exp}))
+		require.NoError(t, err)
+		assert.True(t, token.Valid)
+		assert.Equal(t, "jti", claims.ID)
+		assert.False(t, claims.HasTenantId())
+	})
+
+	t.Run("rejects tokens without jti or exp", func(t *testing.T) {
+		_, _, err := parser.ParseToken(sign(jwt.RegisteredClaims{ExpiresAt: exp}))
+		assert.ErrorIs(t, err, errMissingJtiClaim)
+
+		_, _, err = parser.ParseToken(sign(jwt.RegisteredClaims{ID: "jti"}))
+		assert.ErrorIs(t, err, errMissingExpOneTime)
+	})
+
+	t.Run("rejects expired tokens", func(t *testing.T) {
+		_, _, err := parser.ParseToken(sign(jwt.RegisteredClaims{ID: "jti", ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute))}))
+		var validationErr *jwt.ValidationError
+		require.ErrorAs(t, err, &validationErr)
+		assert.True(t, validationErr.Is(jwt.ErrTokenExpired))
+	})
+
+	t.Run("rejects invalid signatures", func(t *testing.T) {
+		tokenStr, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{ID: "jti", ExpiresAt: exp}).SignedString([]byte("other-key"))
+		require.NoError(t, err)
+		_, _, err = parser.ParseToken(tokenStr)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,103 @@
+package authn
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxRevocationBodySize limits the size of requests to RevocationHandler.
+const maxRevocationBodySize = 64 << 10
+
+var (
+	errRevocationUnauthenticated = errors.New("authentication required")
+	errRevocationForbidden       = errors.New("insufficient permissions")
+)
+
+// RevocationAuthorizer reports whether the caller authenticated with the given Jwt may add revocations. obj is nil
+// for unauthenticated requests.
+type RevocationAuthorizer func(obj *Jwt) error
+
+// RequireRevocationRole returns a RevocationAuthorizer accepting callers with the given role, see Claims.HasRole.
+func RequireRevocationRole(role string) RevocationAuthorizer {
+	return func(obj *Jwt) error {
+		if obj == nil || obj.Claims == nil || obj.Token == nil || !obj.Token.Valid {
+			return errRevocationUnauthenticated
+		}
+		if !obj.Claims.HasRole(role) {
+			return errRevocationForbidden
+		}
+		return nil
+	}
+}
+
+// RevocationHandler is an admin endpoint adding revocations to a RevocationStore. It accepts POST requests with a
+// JSON encoded Revocation and responds with 204 No Content.
+//
+// Callers are authorized with the Jwt on the request context, which must be set by a preceding middleware like
+// JwtMiddleware. Use Gin with gin, since the JwtMiddleware sets the Jwt on the gin context only. Add CsrfProtection
+// if tokens may be read from cookies.
+type RevocationHandler struct {
+	store     RevocationStore
+	authorize RevocationAuthorizer
+}
+
+// NewRevocationHandler creates a RevocationHandler adding revocations to store if authorize accepts the caller. If
+// authorize is nil, all requests are rejected.
+func NewRevocationHandler(store RevocationStore, authorize RevocationAuthorizer) *RevocationHandler {
+	return &RevocationHandler{store: store, authorize: authorize}
+}
+
+// Gin serves the request using the Jwt on the gin context.
+func (h *RevocationHandler) Gin(ctx *gin.Context) {
+	h.serve(ctx.Writer, ctx.Request, GetCtxJwt(ctx))
+	// Responses without body are only written by gin when the handler chain ends
+	ctx.Writer.WriteHeaderNow()
+}
+
+func (h *RevocationHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	h.serve(writer, request, GetCtxJwt(request.Context()))
+}
+
+func (h *RevocationHandler) serve(writer http.ResponseWriter, request *http.Request, obj *Jwt) {
+	writer.Header().Set("Cache-Control", "no-store")
+
+	if h.authorize == nil {
+		http.Error(writer, errRevocationForbidden.Error(), http.StatusForbidden)
+		return
+	}
+	if err := h.authorize(obj); err != nil {
+		status := http.StatusForbidden
+		if errors.Is(err, errRevocationUnauthenticated) {
+			status = http.StatusUnauthorized
+		}
+		http.Error(writer, err.Error(), status)
+		return
+	}
+
+	if request.Method != http.MethodPost {
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var revocation Revocation
+	decoder := json.NewDecoder(http.MaxBytesReader(writer, request.Body, maxRevocationBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&revocation); err != nil {
+		http.Error(writer, "invalid revocation: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.store.Revoke(revocation); err != nil {
+		if errors.Is(err, ErrInvalidRevocation) {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(writer, "storing revocation failed", http.StatusInternalServerError)
+		return
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,212 @@
+package authn
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// defaultRevocationRetention is the default duration for which revocations are remembered.
+const defaultRevocationRetention = time.Hour
+
+// SessionRevoker is notified about sessions which have been ended at the issuer, e.g. via back-channel logout.
+type SessionRevoker interface {
+	// RevokeSession revokes the session with the given id. If sessionId is empty, all sessions of the subject are
+	// revoked.
+	RevokeSession(issuer string, sessionId string, subject string) error
+}
+
+// RevocationChecker decides whether tokens have been revoked before their expiry. See WithRevocations.
+type RevocationChecker interface {
+	// IsRevoked reports whether the token of the given claims has been revoked. Implementations which cannot reach
+	// their backing store should report tokens as revoked.
+	IsRevoked(claims *Claims) bool
+}
+
+// RevocationStore is a RevocationChecker to which revocations can be added.
+type RevocationStore interface {
+	RevocationChecker
+
+	// Revoke adds the given revocation. Revocations of the same kind, issuer and value are merged.
+	Revoke(revocation Revocation) error
+}
+
+// RevocationKind defines what tokens a Revocation applies to.
+type RevocationKind string
+
+const (
+	// RevocationKindTokenId revokes the token with the "jti" claim Revocation.Value.
+	RevocationKindTokenId RevocationKind = "jti"
+	// RevocationKindSession revokes all tokens with the "sid" claim Revocation.Value.
+	RevocationKindSession RevocationKind = "sid"
+	// RevocationKindSubject revokes tokens of the subject Revocation.Value issued up to Revocation.NotBefore.
+	RevocationKindSubject RevocationKind = "sub"
+	// RevocationKindTenant revokes tokens of the tenant id Revocation.Value issued up to Revocation.NotBefore.
+	RevocationKindTenant RevocationKind = "tenant_id"
+)
+
+var (
+	ErrInvalidRevocation = errors.New("invalid revocation")
+
+	// errTokenRevoked is returned by AuthStack.ParseToken for revoked tokens.
+	errTokenRevoked = jwt.NewValidationError("token has been revoked", jwt.ValidationErrorClaimsInvalid)
+)
+
+// Revocation is an entry of a RevocationStore.
+type Revocation struct {
+	Kind RevocationKind `json:"kind"`
+	// Issuer restricts the revocation to tokens of an issuer. If empty, tokens of all issuers are affected.
+	Issuer string `json:"iss,omitempty"`
+	Value  string `json:"value"`
+
+	// NotBefore is the time up to which tokens are rejected if they have been issued at or before it. Only used for
+	// subject and tenant revocations. Defaults to the time the revocation is added.
+	NotBefore time.Time `json:"not_before,omitempty"`
+	// ExpiresAt is the time after which the revocation is pruned. It must not be before the expiry of the affected
+	// tokens. Defaults to the retention of the store.
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+// Validate checks that the revocation is complete.
+func (r *Revocation) Validate() error {
+	switch r.Kind {
+	case RevocationKindTokenId, RevocationKindSession, RevocationKindSubject, RevocationKindTenant:
+	default:
+		return fmt.Errorf("%w: unknown kind %q", ErrInvalidRevocation, r.Kind)
+	}
+	if r.Value == "" {
+		return fmt.Errorf("%w: missing value", ErrInvalidRevocation)
+	}
+	return nil
+}
+
+type revocationKey struct {
+	kind   RevocationKind
+	issuer string
+	value  string
+}
+
+// MemoryRevocationStore is a RevocationStore keeping revocations in memory. Each instance of a service must receive
+// the revocations, e.g. via RevocationHandler or back-channel logout.
+//
+// Revocations are pruned once they expire. It also implements SessionRevoker, so that sessions ended at the issuer
+// can be revoked.
+type MemoryRevocationStore struct {
+	retention time.Duration
+	now       func() time.Time
+
+	lock        sync.RWMutex
+	revocations map[revocationKey]*Revocation
+}
+
+// NewMemoryRevocationStore creates a MemoryRevocationStore. Revocations without expiry are kept for the given
+// retention, which must be at least the lifetime of access tokens. If retention is zero, a default of one hour is
+// used.
+func NewMemoryRevocationStore(retention time.Duration) *MemoryRevocationStore {
+	if retention == 0 {
+		retention = defaultRevocationRetention
+	}
+	return &MemoryRevocationStore{
+		retention:   retention,
+		now:         time.Now,
+		revocations: map[revocationKey]*Revocation{},
+	}
+}
+
+func (s *MemoryRevocationStore) Revoke(revocation Revocation) error {
+	if err := revocation.Validate(); err != nil {
+		return err
+	}
+
+	now := s.now()
+	if revocation.NotBefore.IsZero() {
+		revocation.NotBefore = now
+	}
+	if revocation.ExpiresAt.IsZero() {
+		revocation.ExpiresAt = now.Add(s.retention)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.prune(now)
+
+	key := revocationKey{kind: revocation.Kind, issuer: revocation.Issuer, value: revocation.Value}
+	if existing, ok := s.revocations[key]; ok {
+		if existing.NotBefore.After(revocation.NotBefore) {
+			revocation.NotBefore = existing.NotBefore
+		}
+		if existing.ExpiresAt.After(revocation.ExpiresAt) {
+			revocation.ExpiresAt = existing.ExpiresAt
+		}
+	}
+	s.revocations[key] = &revocation
+
+	return nil
+}
+
+func (s *MemoryRevocationStore) RevokeSession(issuer string, sessionId string, subject string) error {
+	if sessionId != "" {
+		return s.Revoke(Revocation{Kind: RevocationKindSession, Issuer: issuer, Value: sessionId})
+	}
+	return s.Revoke(Revocation{Kind: RevocationKindSubject, Issuer: issuer, Value: subject})
+}
+
+func (s *MemoryRevocationStore) IsRevoked(claims *Claims) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if claims.ID != "" && s.lookup(RevocationKindTokenId, claims.Issuer, claims.ID) != nil {
+		return true
+	}
+	if claims.SessionId != "" && s.lookup(RevocationKindSession, claims.Issuer, claims.SessionId) != nil {
+		return true
+	}
+	if claims.Subject != "" && issuedNotAfter(claims, s.lookup(RevocationKindSubject, claims.Issuer, claims.Subject)) {
+		return true
+	}
+	if claims.HasTenantId() && issuedNotAfter(claims, s.lookup(RevocationKindTenant, claims.Issuer, claims.TenantId.String())) {
+		return true
+	}
+	return false
+}
+
+// lookup returns the unexpired revocation for the given issuer or for all issuers. Must be called with the lock held.
+func (s *MemoryRevocationStore) lookup(kind RevocationKind, issuer string, value string) *Revocation {
+	now := s.now()
+	for _, key := range []revocationKey{{kind: kind, issuer: issuer, value: value}, {kind: kind, value: value}} {
+		if revocation, ok := s.revocations[key]; ok && now.Before(revocation.ExpiresAt) {
+			return revocation
+		}
+	}
+	return nil
+}
+
+// issuedNotAfter reports whether the token of the given claims has been issued at or before the NotBefore time of
+// the revocation. Tokens without "iat" claim are considered as issued before.
+func issuedNotAfter(claims *Claims, revocation *Revocation) bool {
+	if revocation == nil {
+		return false
+	}
+	return claims.IssuedAt == nil || !claims.IssuedAt.Time.After(revocation.NotBefore)
+}
+
+// Prune removes expired revocations. This also happens whenever revocations are added.
+func (s *MemoryRevocationStore) Prune() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.prune(s.now())
+}
+
+// prune removes expired revocations. Must be called with the lock held.
+func (s *MemoryRevocationStore) prune(now time.Time) {
+	for key, revocation := range s.revocations {
+		if !now.Before(revocation.ExpiresAt) {
+			delete(s.revocations, key)
+		}
+	}
+}
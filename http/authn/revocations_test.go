@@ -0,0 +1,181 @@
+package authn
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryRevocationStore(t *testing.T) {
+	now := time.Now()
+	tenantId := uuid.New()
+	newStore := func() *MemoryRevocationStore {
+		store := NewMemoryRevocationStore(time.Hour)
+		store.now = func() time.Time { return now }
+		return store
+	}
+	newClaims := func(issuedAt time.Time) *Claims {
+		return &Claims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:   "iss",
+				Subject:  "sub",
+				ID:       "jti",
+				IssuedAt: jwt.NewNumericDate(issuedAt),
+			},
+			SessionId: "sid",
+			TenantId:  tenantId,
+		}
+	}
+
+	t.Run("revokes by token id", func(t *testing.T) {
+		store := newStore()
+		require.NoError(t, store.Revoke(Revocation{Kind: RevocationKindTokenId, Issuer: "iss", Value: "jti"}))
+
+		assert.True(t, store.IsRevoked(newClaims(now)))
+		other := newClaims(now)
+		other.ID = "other"
+		assert.False(t, store.IsRevoked(other))
+	})
+
+	t.Run("matches issuer", func(t *testing.T) {
+		store := newStore()
+		require.NoError(t, store.Revoke(Revocation{Kind: RevocationKindSession, Issuer: "other", Value: "sid"}))
+		assert.False(t, store.IsRevoked(newClaims(now)))
+
+		require.NoError(t, store.Revoke(Revocation{Kind: RevocationKindSession, Value: "sid"}))
+		assert.True(t, store.IsRevoked(newClaims(now)))
+	})
+
+	t.Run("revokes tokens of tenant issued before", func(t *testing.T) {
+		store := newStore()
+		require.NoError(t, store.Revoke(Revocation{Kind: RevocationKindTenant, Value: tenantId.String()}))
+
+		assert.True(t, store.IsRevoked(newClaims(now.Add(-time.Minute))))
+		assert.False(t, store.IsRevoked(newClaims(now.Add(time.Minute))))
+	})
+
+	t.Run("keeps the latest not before time", func(t *testing.T) {
+		store := newStore()
+		require.NoError(t, store.Revoke(Revocation{Kind: RevocationKindSubject, Issuer: "iss", Value: "sub", NotBefore: now.Add(time.Minute)}))
+		require.NoError(t, store.Revoke(Revocation{Kind: RevocationKindSubject, Issuer: "iss", Value: "sub", NotBefore: now.Add(-time.Minute)}))
+
+		assert.True(t, store.IsRevoked(newClaims(now)))
+	})
+
+	t.Run("prunes expired revocations", func(t *testing.T) {
+		store := newStore()
+		require.NoError(t, store.Revoke(Revocation{Kind: RevocationKindTokenId, Issuer: "iss", Value: "jti", ExpiresAt: now.Add(time.Minute)}))
+
+		now = now.Add(time.Minute)
+		assert.False(t, store.IsRevoked(newClaims(now)))
+		store.Prune()
+		assert.Empty(t, store.revocations)
+	})
+
+	t.Run("rejects invalid revocations", func(t *testing.T) {
+		store := newStore()
+		assert.ErrorIs(t, store.Revoke(Revocation{Kind: "unknown", Value: "x"}), ErrInvalidRevocation)
+		assert.ErrorIs(t, store.Revoke(Revocation{Kind: RevocationKindTokenId}), ErrInvalidRevocation)
+	})
+}
+
+func TestMemoryRevocationStore_RevokeSession(t *testing.T) {
+	now := time.Now()
+	revocations := NewMemoryRevocationStore(time.Hour)
+	revocations.now = func() time.Time { return now }
+
+	newClaims := func(sessionId string, issuedAt time.Time) *Claims {
+		return &Claims{
+			RegisteredClaims: jwt.RegisteredClaims{Issuer: "iss", Subject: "sub", IssuedAt: jwt.NewNumericDate(issuedAt)},
+			SessionId:        sessionId,
+		}
+	}
+
+	t.Run("revokes all sessions of subject", func(t *testing.T) {
+		require.NoError(t, revocations.RevokeSession("iss", "", "sub"))
+		assert.True(t, revocations.IsRevoked(newClaims("a", now.Add(-time.Minute))))
+		assert.False(t, revocations.IsRevoked(newClaims("a", now.Add(time.Minute))))
+	})
+
+	t.Run("forgets revocations after retention", func(t *testing.T) {
+		require.NoError(t, revocations.RevokeSession("iss", "b", "sub"))
+		assert.True(t, revocations.IsRevoked(newClaims("b", now.Add(time.Minute))))
+
+		now = now.Add(2 * time.Hour)
+		require.NoError(t, revocations.RevokeSession("iss", "c", "sub"))
+		assert.False(t, revocations.IsRevoked(newClaims("b", now.Add(-3*time.Hour))))
+	})
+}
+
+func TestRevocationHandler(t *testing.T) {
+	store := NewMemoryRevocationStore(0)
+	handler := NewRevocationHandler(store, RequireRevocationRole("admin"))
+
+	newJwt := func(roles ...string) *Jwt {
+		claims := &Claims{RealmAccess: map[string][]string{"roles": roles}}
+		return &Jwt{Token: &jwt.Token{Valid: true, Claims: claims}, Claims: claims}
+	}
+
+	serveAs := func(obj *Jwt, method string, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, "/revocations", strings.NewReader(body))
+		if obj != nil {
+			request = request.WithContext(SetCtxJwt(request.Context(), obj))
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	serve := func(method string, body string) *httptest.ResponseRecorder {
+		return serveAs(newJwt("admin"), method, body)
+	}
+
+	t.Run("requires authorized callers", func(t *testing.T) {
+		body := `{"kind":"jti","iss":"iss","value":"other"}`
+		assert.Equal(t, http.StatusUnauthorized, serveAs(nil, http.MethodPost, body).Code)
+		assert.Equal(t, http.StatusForbidden, serveAs(newJwt("user"), http.MethodPost, body).Code)
+
+		unverified := newJwt("admin")
+		unverified.Token.Valid = false
+		assert.Equal(t, http.StatusUnauthorized, serveAs(unverified, http.MethodPost, body).Code)
+
+		recorder := httptest.NewRecorder()
+		NewRevocationHandler(store, nil).ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/revocations", strings.NewReader(body)))
+		assert.Equal(t, http.StatusForbidden, recorder.Code)
+
+		claims := &Claims{RegisteredClaims: jwt.RegisteredClaims{Issuer: "iss", ID: "other"}}
+		assert.False(t, store.IsRevoked(claims))
+	})
+
+	t.Run("adds revocations", func(t *testing.T) {
+		recorder := serve(http.MethodPost, `{"kind":"jti","iss":"iss","value":"jti"}`)
+		assert.Equal(t, http.StatusNoContent, recorder.Code)
+
+		claims := &Claims{RegisteredClaims: jwt.RegisteredClaims{Issuer: "iss", ID: "jti"}}
+		assert.True(t, store.IsRevoked(claims))
+	})
+
+	t.Run("authorizes jwt of gin context", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(recorder)
+		ctx.Request = httptest.NewRequest(http.MethodPost, "/revocations", strings.NewReader(`{"kind":"jti","iss":"iss","value":"gin"}`))
+		SetCtxJwtGin(ctx, newJwt("admin"))
+
+		handler.Gin(ctx)
+		assert.Equal(t, http.StatusNoContent, recorder.Code)
+	})
+
+	t.Run("rejects invalid requests", func(t *testing.T) {
+		assert.Equal(t, http.StatusMethodNotAllowed, serve(http.MethodGet, "").Code)
+		assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, `{"kind":"jti"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, `{"kind":"jti","value":"x","foo":1}`).Code)
+	})
+}
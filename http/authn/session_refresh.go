@@ -0,0 +1,216 @@
+package authn
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	// defaultRefreshThreshold is the remaining lifetime of access tokens below which they are refreshed.
+	defaultRefreshThreshold = time.Minute
+
+	// refreshGracePeriod is the duration for which the result of a refresh is reused for requests still carrying the
+	// previous refresh token. This is required for parallel requests if Keycloak rotates refresh tokens.
+	refreshGracePeriod = 30 * time.Second
+)
+
+// WithRefreshTokenCookie makes the LoginHandler store refresh tokens in the cookie RefreshTokenCookieName(prefix),
+// encoded with the given encoder. Since refresh tokens are long-lived credentials, the encoder should encrypt them,
+// e.g. AesGcmCookieEncoder.
+//
+// This enables session renewal, see LoginHandler.RenewSession.
+func WithRefreshTokenCookie(encoder CookieEncoder) LoginOption {
+	return func(handler *LoginHandler) {
+		handler.refreshEncoder = encoder
+	}
+}
+
+// WithRefreshThreshold sets the remaining lifetime of access tokens below which they are refreshed. Defaults to one
+// minute.
+func WithRefreshThreshold(threshold time.Duration) LoginOption {
+	return func(handler *LoginHandler) {
+		handler.refreshThreshold = threshold
+	}
+}
+
+// SessionGin is a middleware renewing the session of requests, see RenewSession. It must be used before
+// JwtMiddleware. Requests are never aborted: if renewal fails, JwtMiddleware rejects the expired token.
+func (h *LoginHandler) SessionGin(ctx *gin.Context) {
+	if err := h.RenewSession(ctx.Writer, ctx.Request); err != nil {
+		var oauthErr *OAuthError
+		if !errors.As(err, &oauthErr) {
+			log.Printf("renewing session failed: %v", err)
+		}
+	}
+}
+
+// RenewSession refreshes the access token of the request if it is missing or expires within the refresh threshold
+// and the request carries a refresh token cookie. If a SessionStore is used, the tokens of the stored session are
+// refreshed instead.
+//
+// New tokens are written to the response cookies and to the cookies of the given request, so that subsequent
+// handlers see the new access token. If the issuer rejects the refresh token, e.g. because the session has been
+// revoked, the token cookies are deleted.
+//
+// Returns nil if no refresh has been necessary.
+func (h *LoginHandler) RenewSession(writer http.ResponseWriter, request *http.Request) error {
+	if h.sessions != nil {
+		return h.renewStoredSession(writer, request)
+	}
+	if h.refreshEncoder == nil {
+		return nil
+	}
+
+	refreshCookie, err := request.Cookie(RefreshTokenCookieName(h.cookiePrefix))
+	if err != nil {
+		return nil
+	}
+
+	if !h.needsRefresh(request) {
+		return nil
+	}
+
+	refreshToken, err := h.refreshEncoder.Decode([]byte(refreshCookie.Value))
+	if err != nil {
+		h.deleteTokenCookies(writer)
+		return err
+	}
+
+	tokens, err := h.refreshes.do(string(refreshToken), func() (*tokenResponse, error) {
+		return h.refreshTokens(request.Context(), string(refreshToken))
+	})
+	if err != nil {
+		var oauthErr *OAuthError
+		if errors.As(err, &oauthErr) && oauthErr.Code == "invalid_grant" {
+			h.deleteTokenCookies(writer)
+			deleteRequestCookie(request, AccessTokenCookieName(h.cookiePrefix))
+		}
+		return err
+	}
+
+	h.setTokenCookies(writer, tokens)
+	setRequestCookie(request, AccessTokenCookieName(h.cookiePrefix), string(h.encoder.Encode([]byte(tokens.AccessToken))))
+
+	return nil
+}
+
+// needsRefresh reports whether the access token cookie of the request is missing or about to expire. The token is
+// not verified here, this is left to JwtMiddleware.
+func (h *LoginHandler) needsRefresh(request *http.Request) bool {
+	cookie, err := request.Cookie(AccessTokenCookieName(h.cookiePrefix))
+	if err != nil {
+		return true
+	}
+
+	tokenStr, err := h.encoder.Decode([]byte(cookie.Value))
+	if err != nil {
+		return true
+	}
+
+	return h.expiresSoon(string(tokenStr))
+}
+
+// expiresSoon reports whether the given access token expires within the refresh threshold.
+func (h *LoginHandler) expiresSoon(tokenStr string) bool {
+	claims := &jwt.RegisteredClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenStr, claims); err != nil || claims.ExpiresAt == nil {
+		return true
+	}
+
+	return time.Until(claims.ExpiresAt.Time) < h.refreshThreshold
+}
+
+func (h *LoginHandler) refreshTokens(ctx context.Context, refreshToken string) (*tokenResponse, error) {
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", refreshToken)
+
+	tokens, err := h.requestTokens(ctx, form)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the previous refresh token if the issuer does not rotate refresh tokens
+	if tokens.RefreshToken == "" {
+		tokens.RefreshToken = refreshToken
+	}
+
+	return tokens, nil
+}
+
+// refreshGroup deduplicates refreshes of the same refresh token and keeps successful results for
+// refreshGracePeriod.
+type refreshGroup struct {
+	lock  sync.Mutex
+	calls map[[sha256.Size]byte]*refreshCall
+}
+
+type refreshCall struct {
+	done      chan struct{}
+	tokens    *tokenResponse
+	err       error
+	expiresAt time.Time
+}
+
+func (g *refreshGroup) do(refreshToken string, fn func() (*tokenResponse, error)) (*tokenResponse, error) {
+	key := sha256.Sum256([]byte(refreshToken))
+	now := time.Now()
+
+	g.lock.Lock()
+	if g.calls == nil {
+		g.calls = map[[sha256.Size]byte]*refreshCall{}
+	}
+	for k, call := range g.calls {
+		if !call.expiresAt.IsZero() && now.After(call.expiresAt) {
+			delete(g.calls, k)
+		}
+	}
+	if call, ok := g.calls[key]; ok {
+		g.lock.Unlock()
+		<-call.done
+		return call.tokens, call.err
+	}
+
+	call := &refreshCall{done: make(chan struct{})}
+	g.calls[key] = call
+	g.lock.Unlock()
+
+	call.tokens, call.err = fn()
+
+	g.lock.Lock()
+	if call.err != nil {
+		delete(g.calls, key)
+	} else {
+		call.expiresAt = time.Now().Add(refreshGracePeriod)
+	}
+	g.lock.Unlock()
+	close(call.done)
+
+	return call.tokens, call.err
+}
+
+// setRequestCookie replaces the value of the given cookie on the request.
+func setRequestCookie(request *http.Request, name string, value string) {
+	deleteRequestCookie(request, name)
+	request.AddCookie(&http.Cookie{Name: name, Value: value})
+}
+
+// deleteRequestCookie removes the given cookie from the request.
+func deleteRequestCookie(request *http.Request, name string) {
+	cookies := request.Cookies()
+	request.Header.Del("Cookie")
+	for _, cookie := range cookies {
+		if cookie.Name != name {
+			request.AddCookie(cookie)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package authn
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoginHandler_RenewSession(t *testing.T) {
+	newAccessToken := func(exp time.Duration) string {
+		tokenStr, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(exp)),
+		}).SignedString([]byte("test-signing-key"))
+		require.NoError(t, err)
+		return tokenStr
+	}
+
+	var refreshes atomic.Int32
+	freshToken := newAccessToken(5 * time.Minute)
+	keycloak := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		require.NoError(t, request.ParseForm())
+		require.Equal(t, "refresh_token", request.PostForm.Get("grant_type"))
+
+		if request.PostForm.Get("refresh_token") != "valid-refresh-token" {
+			writer.WriteHeader(http.StatusBadRequest)
+			_, _ = writer.Write([]byte(`{"error":"invalid_grant","error_description":"Session not active"}`))
+			return
+		}
+
+		refreshes.Add(1)
+		time.Sleep(10 * time.Millisecond)
+		_ = json.NewEncoder(writer).Encode(map[string]any{
+			"access_token":       freshToken,
+			"refresh_token":      "rotated-refresh-token",
+			"expires_in":         300,
+			"refresh_expires_in": 1800,
+		})
+	}))
+	defer keycloak.Close()
+
+	refreshEncoder, err := NewAesGcmCookieEncoder([]byte("0123456789abcdef"))
+	require.NoError(t, err)
+	encoder := NewBase64CookieEncoder()
+
+	handler := NewLoginHandler(keycloak.URL+"/realms/test", "web", "https://app.example.com/callback", "dexp", nil,
+		WithRefreshTokenCookie(refreshEncoder))
+
+	newRequest := func(accessToken string, refreshToken string) *http.Request {
+		request := httptest.NewRequest("GET", "/items", nil)
+		if accessToken != "" {
+			request.AddCookie(&http.Cookie{Name: "dexp-at", Value: string(encoder.Encode([]byte(accessToken)))})
+		}
+		request.AddCookie(&http.Cookie{Name: "dexp-rt", Value: string(refreshEncoder.Encode([]byte(refreshToken)))})
+		request.AddCookie(&http.Cookie{Name: "other", Value: "kept"})
+		return request
+	}
+
+	responseCookies := func(rec *httptest.ResponseRecorder) map[string]*http.Cookie {
+		cookies := map[string]*http.Cookie{}
+		for _, cookie := range rec.Result().Cookies() {
+			cookies[cookie.Name] = cookie
+		}
+		return cookies
+	}
+
+	t.Run("keeps valid access tokens", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		require.NoError(t, handler.RenewSession(rec, newRequest(newAccessToken(time.Hour), "valid-refresh-token")))
+		assert.Empty(t, rec.Result().Cookies())
+	})
+
+	t.Run("refreshes expiring access tokens", func(t *testing.T) {
+		request := newRequest(newAccessToken(10*time.Second), "valid-refresh-token")
+		rec := httptest.NewRecorder()
+		require.NoError(t, handler.RenewSession(rec, request))
+
+		cookies := responseCookies(rec)
+		require.Contains(t, cookies, "dexp-at")
+		require.Contains(t, cookies, "dexp-rt")
+		assert.Equal(t, 1800, cookies["dexp-rt"].MaxAge)
+
+		refreshToken, err := refreshEncoder.Decode([]byte(cookies["dexp-rt"].Value))
+		require.NoError(t, err)
+		assert.Equal(t, "rotated-refresh-token", string(refreshToken))
+
+		// The request carries the new token for subsequent handlers
+		token, err := NewJwtCookieExtractor("dexp-at", encoder).ExtractRequestToken(request)
+		require.NoError(t, err)
+		assert.Equal(t, freshToken, token)
+		other, err := request.Cookie("other")
+		require.NoError(t, err)
+		assert.Equal(t, "kept", other.Value)
+	})
+
+	t.Run("refreshes missing access tokens", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		require.NoError(t, handler.RenewSession(rec, newRequest("", "valid-refresh-token")))
+		assert.Contains(t, responseCookies(rec), "dexp-at")
+	})
+
+	t.Run("deduplicates parallel refreshes", func(t *testing.T) {
+		handler := NewLoginHandler(keycloak.URL+"/realms/test", "web", "https://app.example.com/callback", "dexp", nil,
+			WithRefreshTokenCookie(refreshEncoder))
+		refreshes.Store(0)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assert.NoError(t, handler.RenewSession(httptest.NewRecorder(), newRequest("", "valid-refresh-token")))
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, int32(1), refreshes.Load())
+	})
+
+	t.Run("deletes cookies of revoked sessions", func(t *testing.T) {
+		request := newRequest("", "revoked-refresh-token")
+		rec := httptest.NewRecorder()
+
+		err := handler.RenewSession(rec, request)
+		var oauthErr *OAuthError
+		require.ErrorAs(t, err, &oauthErr)
+		assert.Equal(t, "invalid_grant", oauthErr.Code)
+
+		cookies := responseCookies(rec)
+		require.Contains(t, cookies, "dexp-at")
+		require.Contains(t, cookies, "dexp-rt")
+		assert.Equal(t, -1, cookies["dexp-at"].MaxAge)
+		assert.Equal(t, -1, cookies["dexp-rt"].MaxAge)
+	})
+
+	t.Run("ignores requests without refresh token", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		require.NoError(t, handler.RenewSession(rec, httptest.NewRequest("GET", "/items", nil)))
+		assert.Empty(t, rec.Result().Cookies())
+	})
+}
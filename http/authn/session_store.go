@@ -0,0 +1,297 @@
+package authn
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionCookieName returns a standard cookie name to be used for cookies carrying session ids.
+func SessionCookieName(prefix string) string {
+	return prefix + "-session"
+}
+
+// Session holds the tokens of a login on the server side. Clients only receive the opaque session id.
+type Session struct {
+	// Id is the opaque id of the session, sent to clients in a cookie.
+	Id string `json:"id"`
+
+	// Issuer and Subject identify the user of the session.
+	Issuer  string `json:"iss"`
+	Subject string `json:"sub"`
+	// KeycloakSessionId is the "sid" claim of the tokens, used to end sessions via back-channel logout.
+	KeycloakSessionId string `json:"sid,omitempty"`
+
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IdToken      string `json:"id_token,omitempty"`
+
+	// ExpiresAt is the time after which the session can no longer be used. Zero means no expiry.
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Expired reports whether the session has expired at the given time.
+func (s *Session) Expired(now time.Time) bool {
+	return !s.ExpiresAt.IsZero() && !now.Before(s.ExpiresAt)
+}
+
+// SessionStore stores sessions by their id.
+//
+// Implementations must also implement SessionRevoker, so that sessions ended at Keycloak are deleted.
+type SessionStore interface {
+	SessionRevoker
+
+	// Get returns the session with the given id. Returns ErrSessionNotFound if no unexpired session exists.
+	Get(ctx context.Context, id string) (*Session, error)
+	// Save creates or replaces the given session.
+	Save(ctx context.Context, session *Session) error
+	// Delete deletes the session with the given id. Deleting unknown sessions is no error.
+	Delete(ctx context.Context, id string) error
+}
+
+// MemorySessionStore is a SessionStore keeping sessions in memory. Sessions are lost on restart and not shared
+// between instances of a service.
+type MemorySessionStore struct {
+	lock     sync.Mutex
+	sessions map[string]*Session
+	now      func() time.Time
+}
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: map[string]*Session{}, now: time.Now}
+}
+
+func (s *MemorySessionStore) Get(ctx context.Context, id string) (*Session, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok || session.Expired(s.now()) {
+		return nil, ErrSessionNotFound
+	}
+
+	copied := *session
+	return &copied, nil
+}
+
+func (s *MemorySessionStore) Save(ctx context.Context, session *Session) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := s.now()
+	for id, stored := range s.sessions {
+		if stored.Expired(now) {
+			delete(s.sessions, id)
+		}
+	}
+
+	copied := *session
+	s.sessions[session.Id] = &copied
+	return nil
+}
+
+func (s *MemorySessionStore) Delete(ctx context.Context, id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.sessions, id)
+	return nil
+}
+
+func (s *MemorySessionStore) RevokeSession(issuer string, sessionId string, subject string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for id, session := range s.sessions {
+		if matchesRevocation(session, issuer, sessionId, subject) {
+			delete(s.sessions, id)
+		}
+	}
+	return nil
+}
+
+// FileSessionStore is a SessionStore keeping each session in a JSON file of a local directory. Sessions survive
+// restarts but are not shared between hosts.
+//
+// File names are derived from a hash of the session id, so that ids cannot be read from the directory listing.
+type FileSessionStore struct {
+	dir string
+	now func() time.Time
+
+	// lock serializes writes, so that concurrent saves of the same session do not interleave
+	lock sync.Mutex
+}
+
+// NewFileSessionStore creates a FileSessionStore in the given directory, which is created if it does not exist.
+func NewFileSessionStore(dir string) (*FileSessionStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("creating session directory failed: %w", err)
+	}
+	return &FileSessionStore{dir: dir, now: time.Now}, nil
+}
+
+func (s *FileSessionStore) path(id string) string {
+	hash := sha256.Sum256([]byte(id))
+	return filepath.Join(s.dir, hex.EncodeToString(hash[:])+".json")
+}
+
+func (s *FileSessionStore) Get(ctx context.Context, id string) (*Session, error) {
+	session, err := s.read(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if session.Id != id || session.Expired(s.now()) {
+		return nil, ErrSessionNotFound
+	}
+	return session, nil
+}
+
+func (s *FileSessionStore) read(path string) (*Session, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("parsing session file failed: %w", err)
+	}
+	return &session, nil
+}
+
+func (s *FileSessionStore) Save(ctx context.Context, session *Session) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// Write to a temporary file first, so that readers never see partial sessions
+	tmp, err := os.CreateTemp(s.dir, ".session-*")
+	if err != nil {
+		return fmt.Errorf("creating session file failed: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("writing session file failed: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing session file failed: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), s.path(session.Id))
+}
+
+func (s *FileSessionStore) Delete(ctx context.Context, id string) error {
+	err := os.Remove(s.path(id))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *FileSessionStore) RevokeSession(issuer string, sessionId string, subject string) error {
+	return s.walk(func(path string, session *Session) error {
+		if matchesRevocation(session, issuer, sessionId, subject) {
+			return os.Remove(path)
+		}
+		return nil
+	})
+}
+
+// Prune deletes all expired sessions. Call it periodically to free disk space.
+func (s *FileSessionStore) Prune() error {
+	now := s.now()
+	return s.walk(func(path string, session *Session) error {
+		if session.Expired(now) {
+			return os.Remove(path)
+		}
+		return nil
+	})
+}
+
+// walk calls fn for each session file. Unreadable files are skipped.
+func (s *FileSessionStore) walk(fn func(path string, session *Session) error) error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+
+		path := filepath.Join(s.dir, entry.Name())
+		session, err := s.read(path)
+		if err != nil {
+			continue
+		}
+		if err := fn(path, session); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// matchesRevocation reports whether the session is affected by a revocation, see SessionRevoker.
+func matchesRevocation(session *Session, issuer string, sessionId string, subject string) bool {
+	if session.Issuer != issuer {
+		return false
+	}
+	if sessionId != "" {
+		return session.KeycloakSessionId == sessionId
+	}
+	return session.Subject == subject
+}
+
+// SessionTokenExtractor extracts tokens from the SessionStore, using the session id of a cookie.
+type SessionTokenExtractor struct {
+	cookieName string
+	store      SessionStore
+}
+
+// NewSessionTokenExtractor creates a new SessionTokenExtractor reading session ids from the given cookie.
+func NewSessionTokenExtractor(cookieName string, store SessionStore) *SessionTokenExtractor {
+	return &SessionTokenExtractor{cookieName: cookieName, store: store}
+}
+
+func (e *SessionTokenExtractor) TokenSource() TokenSource {
+	return TokenSourceCookie
+}
+
+func (e *SessionTokenExtractor) ExtractRequestToken(request *http.Request) (string, error) {
+	cookie, err := request.Cookie(e.cookieName)
+	if err != nil {
+		return "", nil
+	}
+
+	session, err := e.store.Get(request.Context(), cookie.Value)
+	if errors.Is(err, ErrSessionNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return session.AccessToken, nil
+}
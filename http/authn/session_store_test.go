@@ -0,0 +1,170 @@
+package authn
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionStores(t *testing.T) {
+	fileStore, err := NewFileSessionStore(t.TempDir())
+	require.NoError(t, err)
+
+	stores := map[string]SessionStore{
+		"memory": NewMemorySessionStore(),
+		"file":   fileStore,
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			session := &Session{Id: "a", Issuer: "iss", Subject: "sub", KeycloakSessionId: "sid", AccessToken: "token"}
+
+			_, err := store.Get(ctx, "a")
+			assert.ErrorIs(t, err, ErrSessionNotFound)
+
+			require.NoError(t, store.Save(ctx, session))
+			stored, err := store.Get(ctx, "a")
+			require.NoError(t, err)
+			assert.Equal(t, session, stored)
+
+			require.NoError(t, store.Delete(ctx, "a"))
+			_, err = store.Get(ctx, "a")
+			assert.ErrorIs(t, err, ErrSessionNotFound)
+			assert.NoError(t, store.Delete(ctx, "a"))
+
+			expired := &Session{Id: "b", ExpiresAt: time.Now().Add(-time.Second)}
+			require.NoError(t, store.Save(ctx, expired))
+			_, err = store.Get(ctx, "b")
+			assert.ErrorIs(t, err, ErrSessionNotFound)
+
+			require.NoError(t, store.Save(ctx, session))
+			require.NoError(t, store.Save(ctx, &Session{Id: "c", Issuer: "iss", Subject: "sub", KeycloakSessionId: "other"}))
+			require.NoError(t, store.RevokeSession("iss", "sid", "sub"))
+			_, err = store.Get(ctx, "a")
+			assert.ErrorIs(t, err, ErrSessionNotFound)
+			_, err = store.Get(ctx, "c")
+			assert.NoError(t, err)
+
+			require.NoError(t, store.RevokeSession("iss", "", "sub"))
+			_, err = store.Get(ctx, "c")
+			assert.ErrorIs(t, err, ErrSessionNotFound)
+		})
+	}
+}
+
+func TestSessionTokenExtractor(t *testing.T) {
+	store := NewMemorySessionStore()
+	require.NoError(t, store.Save(context.Background(), &Session{Id: "a", AccessToken: "token"}))
+	extractor := NewSessionTokenExtractor("dexp-session", store)
+
+	request := httptest.NewRequest("GET", "/", nil)
+	token, err := extractor.ExtractRequestToken(request)
+	require.NoError(t, err)
+	assert.Empty(t, token)
+
+	request.AddCookie(&http.Cookie{Name: "dexp-session", Value: "unknown"})
+	token, err = extractor.ExtractRequestToken(request)
+	require.NoError(t, err)
+	assert.Empty(t, token)
+
+	request = httptest.NewRequest("GET", "/", nil)
+	request.AddCookie(&http.Cookie{Name: "dexp-session", Value: "a"})
+	token, source, err := NewTokenExtractorChain().Append(extractor).ExtractRequestTokenSource(request)
+	require.NoError(t, err)
+	assert.Equal(t, "token", token)
+	assert.Equal(t, TokenSourceCookie, source)
+}
+
+func TestLoginHandler_SessionStore(t *testing.T) {
+	newAccessToken := func(exp time.Duration) string {
+		tokenStr, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    "iss",
+				Subject:   "sub",
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(exp)),
+			},
+			SessionId: "sid",
+		}).SignedString([]byte("test-signing-key"))
+		require.NoError(t, err)
+		return tokenStr
+	}
+
+	freshToken := newAccessToken(5 * time.Minute)
+	keycloak := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		require.NoError(t, request.ParseForm())
+		if request.PostForm.Get("refresh_token") != "valid-refresh-token" {
+			writer.WriteHeader(http.StatusBadRequest)
+			_, _ = writer.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		_ = json.NewEncoder(writer).Encode(map[string]any{
+			"access_token":       freshToken,
+			"refresh_token":      "rotated-refresh-token",
+			"expires_in":         300,
+			"refresh_expires_in": 1800,
+		})
+	}))
+	defer keycloak.Close()
+
+	ctx := context.Background()
+	store := NewMemorySessionStore()
+	handler := NewLoginHandler(keycloak.URL+"/realms/test", "web", "https://app.example.com/callback", "dexp", nil,
+		WithSessionStore(store))
+
+	newRequest := func(sessionId string) *http.Request {
+		request := httptest.NewRequest("GET", "/", nil)
+		request.AddCookie(&http.Cookie{Name: "dexp-session", Value: sessionId})
+		return request
+	}
+
+	t.Run("refreshes stored tokens", func(t *testing.T) {
+		require.NoError(t, store.Save(ctx, &Session{Id: "a", AccessToken: newAccessToken(time.Second), RefreshToken: "valid-refresh-token"}))
+
+		rec := httptest.NewRecorder()
+		require.NoError(t, handler.RenewSession(rec, newRequest("a")))
+
+		session, err := store.Get(ctx, "a")
+		require.NoError(t, err)
+		assert.Equal(t, freshToken, session.AccessToken)
+		assert.Equal(t, "rotated-refresh-token", session.RefreshToken)
+		assert.Equal(t, "sid", session.KeycloakSessionId)
+		assert.WithinDuration(t, time.Now().Add(30*time.Minute), session.ExpiresAt, time.Minute)
+
+		cookies := rec.Result().Cookies()
+		require.Len(t, cookies, 1)
+		assert.Equal(t, "a", cookies[0].Value)
+	})
+
+	t.Run("deletes revoked sessions", func(t *testing.T) {
+		require.NoError(t, store.Save(ctx, &Session{Id: "b", AccessToken: newAccessToken(time.Second), RefreshToken: "revoked"}))
+
+		assert.Error(t, handler.RenewSession(httptest.NewRecorder(), newRequest("b")))
+		_, err := store.Get(ctx, "b")
+		assert.ErrorIs(t, err, ErrSessionNotFound)
+	})
+
+	t.Run("logout deletes session", func(t *testing.T) {
+		require.NoError(t, store.Save(ctx, &Session{Id: "c", AccessToken: freshToken, IdToken: "test-id-token"}))
+
+		rec := httptest.NewRecorder()
+		request := newRequest("c")
+		request.Method = "POST"
+		handler.Logout(rec, request)
+
+		location, err := url.Parse(rec.Header().Get("Location"))
+		require.NoError(t, err)
+		assert.Equal(t, "test-id-token", location.Query().Get("id_token_hint"))
+
+		_, err = store.Get(ctx, "c")
+		assert.ErrorIs(t, err, ErrSessionNotFound)
+	})
+}
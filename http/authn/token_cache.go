@@ -0,0 +1,215 @@
+package authn
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	defaultTokenCacheMaxSize = 10000
+	defaultTokenCacheMaxTTL  = 5 * time.Minute
+)
+
+// TokenCache caches successfully validated tokens, so that repeated requests with the same token do not need to
+// verify its signature again.
+//
+// Entries are keyed by a SHA-256 hash of the token string and kept until the token expires, bounded by a max TTL.
+// If the cache is full, the least recently used entry is evicted.
+//
+// Cached tokens and claims are shared between requests and must not be modified.
+type TokenCache struct {
+	maxSize int
+	maxTTL  time.Duration
+	now     func() time.Time
+
+	lock    sync.Mutex
+	entries map[[sha256.Size]byte]*list.Element
+	// order holds *tokenCacheEntry values, the most recently used entry at the front.
+	order *list.List
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+type tokenCacheEntry struct {
+	key       [sha256.Size]byte
+	token     *jwt.Token
+	claims    *Claims
+	expiresAt time.Time
+	// validatedAt is the time the token has been validated by the parser.
+	validatedAt time.Time
+}
+
+// TokenCacheOption configures optional behaviour of a TokenCache.
+type TokenCacheOption func(cache *TokenCache)
+
+// WithTokenCacheMaxSize sets the maximum number of cached tokens. Defaults to 10000.
+func WithTokenCacheMaxSize(size int) TokenCacheOption {
+	return func(cache *TokenCache) {
+		cache.maxSize = size
+	}
+}
+
+// WithTokenCacheMaxTTL sets the maximum duration a token is cached, regardless of its expiry. Defaults to 5 minutes.
+func WithTokenCacheMaxTTL(ttl time.Duration) TokenCacheOption {
+	return func(cache *TokenCache) {
+		cache.maxTTL = ttl
+	}
+}
+
+func NewTokenCache(opts ...TokenCacheOption) *TokenCache {
+	cache := &TokenCache{
+		maxSize: defaultTokenCacheMaxSize,
+		maxTTL:  defaultTokenCacheMaxTTL,
+		now:     time.Now,
+		entries: map[[sha256.Size]byte]*list.Element{},
+		order:   list.New(),
+	}
+	for _, opt := range opts {
+		opt(cache)
+	}
+	return cache
+}
+
+// TokenCacheStats are counters describing the usage of a TokenCache.
+type TokenCacheStats struct {
+	Hits   uint64
+	Misses uint64
+	Size   int
+}
+
+// Stats returns the current counters of the cache.
+func (c *TokenCache) Stats() TokenCacheStats {
+	c.lock.Lock()
+	size := len(c.entries)
+	c.lock.Unlock()
+
+	return TokenCacheStats{Hits: c.hits.Load(), Misses: c.misses.Load(), Size: size}
+}
+
+// Get returns the cached token and claims for the given token string.
+func (c *TokenCache) Get(tokenStr string) (*jwt.Token, *Claims, bool) {
+	entry, ok := c.get(tokenStr)
+	if !ok {
+		return nil, nil, false
+	}
+	return entry.token, entry.claims, true
+}
+
+// get returns the unexpired entry of the given token.
+func (c *TokenCache) get(tokenStr string) (*tokenCacheEntry, bool) {
+	key := sha256.Sum256([]byte(tokenStr))
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		c.misses.Add(1)
+		return nil, false
+	}
+
+	entry := elem.Value.(*tokenCacheEntry)
+	if !c.now().Before(entry.expiresAt) {
+		c.remove(elem)
+		c.misses.Add(1)
+		return nil, false
+	}
+
+	c.order.MoveToFront(elem)
+	c.hits.Add(1)
+	return entry, true
+}
+
+// Add caches the given validated token. Tokens which are already expired are not cached.
+func (c *TokenCache) Add(tokenStr string, token *jwt.Token, claims *Claims) {
+	c.add(tokenStr, token, claims, c.now())
+}
+
+// add caches the given token which has been validated at validatedAt.
+func (c *TokenCache) add(tokenStr string, token *jwt.Token, claims *Claims, validatedAt time.Time) {
+	now := c.now()
+	expiresAt := now.Add(c.maxTTL)
+	if claims.ExpiresAt != nil && claims.ExpiresAt.Time.Before(expiresAt) {
+		expiresAt = claims.ExpiresAt.Time
+	}
+	if !now.Before(expiresAt) || c.maxSize <= 0 {
+		return
+	}
+
+	key := sha256.Sum256([]byte(tokenStr))
+	entry := &tokenCacheEntry{key: key, token: token, claims: claims, expiresAt: expiresAt, validatedAt: validatedAt}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	for len(c.entries) >= c.maxSize {
+		c.remove(c.order.Back())
+	}
+	c.entries[key] = c.order.PushFront(entry)
+}
+
+// Purge removes all entries from the cache. This is called when signing keys change, so that tokens of removed
+// keys are verified again.
+func (c *TokenCache) Purge() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.entries = map[[sha256.Size]byte]*list.Element{}
+	c.order.Init()
+}
+
+// PurgeOnKeyChange purges the cache whenever the given JwksManager observes changed keys.
+func (c *TokenCache) PurgeOnKeyChange(manager *JwksManager) {
+	manager.OnKeysChanged(func(url string) {
+		c.Purge()
+	})
+}
+
+func (c *TokenCache) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*tokenCacheEntry).key)
+}
+
+// CachingTokenParser is a TokenParser which caches the tokens validated by another TokenParser.
+type CachingTokenParser struct {
+	parser TokenParser
+	cache  *TokenCache
+}
+
+func NewCachingTokenParser(parser TokenParser, cache *TokenCache) *CachingTokenParser {
+	return &CachingTokenParser{parser: parser, cache: cache}
+}
+
+func (p *CachingTokenParser) ParseToken(tokenString string) (*jwt.Token, *Claims, error) {
+	token, claims, _, err := p.ParseTokenValidatedAt(tokenString)
+	return token, claims, err
+}
+
+// ParseTokenValidatedAt returns cached tokens with the time they have originally been validated at.
+func (p *CachingTokenParser) ParseTokenValidatedAt(tokenString string) (*jwt.Token, *Claims, time.Time, error) {
+	if entry, ok := p.cache.get(tokenString); ok {
+		return entry.token, entry.claims, entry.validatedAt, nil
+	}
+
+	token, claims, validatedAt, err := ParseTokenValidatedAt(p.parser, tokenString)
+	if err != nil {
+		return nil, nil, time.Time{}, err
+	}
+	if token.Valid {
+		p.cache.add(tokenString, token, claims, validatedAt)
+	}
+
+	return token, claims, validatedAt, nil
+}
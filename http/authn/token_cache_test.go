@@ -0,0 +1,140 @@
+package authn
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenCache(t *testing.T) {
+	now := time.Now()
+	newCache := func(opts ...TokenCacheOption) *TokenCache {
+		cache := NewTokenCache(opts...)
+		cache.now = func() time.Time { return now }
+		return cache
+	}
+	newClaims := func(exp time.Duration) *Claims {
+		return &Claims{RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(now.Add(exp))}}
+	}
+
+	t.Run("caches until expiry", func(t *testing.T) {
+		cache := newCache()
+		claims := newClaims(time.Minute)
+		cache.Add("token", &jwt.Token{Valid: true}, claims)
+
+		_, cached, ok := cache.Get("token")
+		require.True(t, ok)
+		assert.Same(t, claims, cached)
+
+		now = now.Add(time.Minute)
+		_, _, ok = cache.Get("token")
+		assert.False(t, ok)
+		assert.Equal(t, TokenCacheStats{Hits: 1, Misses: 1, Size: 0}, cache.Stats())
+	})
+
+	t.Run("bounds expiry by max ttl", func(t *testing.T) {
+		cache := newCache(WithTokenCacheMaxTTL(time.Second))
+		cache.Add("token", &jwt.Token{Valid: true}, newClaims(time.Hour))
+
+		now = now.Add(time.Second)
+		_, _, ok := cache.Get("token")
+		assert.False(t, ok)
+	})
+
+	t.Run("does not cache expired tokens", func(t *testing.T) {
+		cache := newCache()
+		cache.Add("token", &jwt.Token{Valid: true}, newClaims(-time.Second))
+		assert.Equal(t, 0, cache.Stats().Size)
+	})
+
+	t.Run("evicts least recently used entries", func(t *testing.T) {
+		cache := newCache(WithTokenCacheMaxSize(2))
+		cache.Add("a", &jwt.Token{Valid: true}, newClaims(time.Minute))
+		cache.Add("b", &jwt.Token{Valid: true}, newClaims(time.Minute))
+		_, _, _ = cache.Get("a")
+		cache.Add("c", &jwt.Token{Valid: true}, newClaims(time.Minute))
+
+		_, _, ok := cache.Get("a")
+		assert.True(t, ok)
+		_, _, ok = cache.Get("b")
+		assert.False(t, ok)
+		_, _, ok = cache.Get("c")
+		assert.True(t, ok)
+	})
+
+	t.Run("purges on key change", func(t *testing.T) {
+		manager := NewJwksManager()
+		cache := newCache()
+		cache.PurgeOnKeyChange(manager)
+		cache.Add("token", &jwt.Token{Valid: true}, newClaims(time.Minute))
+
+		manager.observe("https://example.com/certs", []byte(`{"keys":[1]}`))
+		manager.observe("https://example.com/certs", []byte(`{"keys":[1]}`))
+		assert.Equal(t, 1, cache.Stats().Size)
+
+		manager.observe("https://example.com/certs", []byte(`{"keys":[2]}`))
+		assert.Equal(t, 0, cache.Stats().Size)
+	})
+}
+
+func TestAuthStack_TokenCache(t *testing.T) {
+	key := []byte("test-signing-key")
+	calls := 0
+	keyfunc := func(token *jwt.Token) (interface{}, error) {
+		calls++
+		return key, nil
+	}
+
+	newToken := func(exp time.Duration) string {
+		claims := &Claims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(exp)),
+				IssuedAt:  jwt.NewNumericDate(time.Now().Add(-time.Minute)),
+			},
+			TenantId:   uuid.New(),
+			TenantName: "test",
+		}
+		tokenStr, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+		require.NoError(t, err)
+		return tokenStr
+	}
+
+	cache := NewTokenCache()
+	stack := NewAuthStack(NewTokenExtractorChain(), keyfunc, WithTokenCache(cache))
+
+	t.Run("verifies valid tokens once", func(t *testing.T) {
+		tokenStr := newToken(time.Minute)
+		for i := 0; i < 3; i++ {
+			token, claims, err := stack.ParseToken(tokenStr)
+			require.NoError(t, err)
+			assert.True(t, token.Valid)
+			assert.NotNil(t, claims)
+		}
+		assert.Equal(t, 1, calls)
+		assert.Equal(t, uint64(2), cache.Stats().Hits)
+	})
+
+	t.Run("does not cache invalid tokens", func(t *testing.T) {
+		tokenStr := newToken(-time.Second)
+		for i := 0; i < 2; i++ {
+			_, _, err := stack.ParseToken(tokenStr)
+			assert.Error(t, err)
+		}
+		assert.Equal(t, 1, cache.Stats().Size)
+	})
+
+	t.Run("reports the original validation time of cached tokens", func(t *testing.T) {
+		tokenStr := newToken(time.Minute)
+		_, _, validatedAt, err := stack.ParseTokenValidatedAt(tokenStr)
+		require.NoError(t, err)
+
+		time.Sleep(10 * time.Millisecond)
+		_, _, cachedAt, err := stack.ParseTokenValidatedAt(tokenStr)
+		require.NoError(t, err)
+		assert.Equal(t, validatedAt, cachedAt)
+	})
+}
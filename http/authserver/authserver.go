@@ -13,53 +13,202 @@ import (
 // Trusted requests are responded with a status 204 and additional headers containing decoded information about the request
 // user, etc.
 //
-// Untrusted requests are responded with a status 401.
+// Untrusted requests are responded with a status 401. Trusted requests not satisfying the configured AccessRules are
+// responded with a status 403. Browsers may be redirected to the login instead, see WithLoginRedirect.
 type AuthServer struct {
-	stack *authn.AuthStack
+	stack         *authn.AuthStack
+	signer        *HeaderSigner
+	forwardTokens bool
+	codec         *HeaderCodec
+
+	emitClaimHeaders bool
+	claimHeaders     ClaimHeaderMapping
+
+	rules AccessRules
+
+	loginRedirect *LoginRedirect
+}
+
+// AuthServerOption configures optional behaviour of an AuthServer.
+type AuthServerOption func(server *AuthServer)
+
+// WithHeaderSigner makes the AuthServer sign its headers. The signature is bound to the method and path of the
+// original request as passed by the forward-auth proxy.
+func WithHeaderSigner(signer *HeaderSigner) AuthServerOption {
+	return func(server *AuthServer) {
+		server.signer = signer
+	}
+}
+
+// WithTokenForwarding makes the AuthServer forward the original access token to upstream services, e.g. to call
+// other APIs on behalf of the user. The token is available via Header.TokenStr and, for verified headers,
+// GetContextJwt.
+func WithTokenForwarding() AuthServerOption {
+	return func(server *AuthServer) {
+		server.forwardTokens = true
+	}
+}
+
+// WithClaimHeaders makes the AuthServer set a flat header per claim in addition to the JSON claims header. If
+// mapping is nil, the mapping of the HeaderCodec is used.
+func WithClaimHeaders(mapping ClaimHeaderMapping) AuthServerOption {
+	return func(server *AuthServer) {
+		server.emitClaimHeaders = true
+		server.claimHeaders = mapping
+	}
 }
 
-func NewAuthServer(stack *authn.AuthStack) *AuthServer {
-	return &AuthServer{stack: stack}
+// WithHeaderCodec sets the codec used to encode headers. Services parsing the headers must use the same codec
+// configuration.
+func WithHeaderCodec(codec *HeaderCodec) AuthServerOption {
+	return func(server *AuthServer) {
+		server.codec = codec
+	}
+}
+
+// WithAccessRules makes the AuthServer check requests against the given rules. Requests not matching any rule only
+// require a valid token.
+func WithAccessRules(rules ...AccessRule) AuthServerOption {
+	return func(server *AuthServer) {
+		server.rules = rules
+	}
+}
+
+func NewAuthServer(stack *authn.AuthStack, opts ...AuthServerOption) *AuthServer {
+	server := &AuthServer{stack: stack, codec: defaultHeaderCodec}
+	for _, opt := range opts {
+		opt(server)
+	}
+	return server
+}
+
+// HeaderCodec returns the codec used to encode headers.
+func (server *AuthServer) HeaderCodec() *HeaderCodec {
+	return server.codec
+}
+
+// Decision is the outcome of authenticating a request via AuthServer.Authenticate.
+type Decision struct {
+	// Status is the HTTP status code to respond with. It is http.StatusNoContent for trusted requests.
+	Status int
+	// Message describes why a request has not been trusted. It is empty for trusted requests.
+	Message string
+	// Header holds the headers to pass to upstream services for trusted requests and the headers of the error
+	// response otherwise.
+	Header http.Header
+}
+
+// Allowed reports whether the request is trusted.
+func (d *Decision) Allowed() bool {
+	return d.Status == http.StatusNoContent
+}
+
+func deny(status int, message string) *Decision {
+	return &Decision{Status: status, Message: message, Header: http.Header{}}
 }
 
 func (server *AuthServer) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	decision := server.Authenticate(request)
+
+	for name, values := range decision.Header {
+		writer.Header()[name] = values
+	}
+
+	if !decision.Allowed() {
+		http.Error(writer, decision.Message, decision.Status)
+		return
+	}
+
+	writer.WriteHeader(decision.Status)
+}
+
+// Authenticate validates the authentication information of the given request. This is the transport independent
+// part of ServeHTTP.
+func (server *AuthServer) Authenticate(request *http.Request) *Decision {
+	method, path, err := originalRequest(request)
+	if err != nil {
+		return deny(http.StatusBadRequest, err.Error())
+	}
+	rule := server.rules.Match(method, path)
+
+	decision := server.authenticate(request, method, path, rule)
+	if rule != nil && rule.Public && decision.Status == http.StatusUnauthorized {
+		// Public paths are accessible without valid tokens, malformed requests are still rejected
+		return &Decision{Status: http.StatusNoContent, Header: http.Header{}}
+	}
+
+	if decision.Status == http.StatusUnauthorized && server.loginRedirect != nil {
+		if redirect := server.loginRedirect.redirect(request); redirect != nil {
+			return redirect
+		}
+	}
+
+	return decision
+}
+
+func (server *AuthServer) authenticate(request *http.Request, method, path string, rule *AccessRule) *Decision {
 	// Get authentication information from request
-	tokenStr, err := server.stack.ExtractRequestToken(request)
+	tokenStr, source, err := server.stack.ExtractRequestTokenSource(request)
+	if errors.Is(err, authn.ErrInvalidRequest) {
+		decision := deny(http.StatusBadRequest, err.Error())
+		decision.Header.Set("WWW-Authenticate", `Bearer error="invalid_request"`)
+		return decision
+	}
 	if err != nil {
-		http.Error(writer, "extracting request token failed", 500)
-		return
+		return deny(http.StatusInternalServerError, "extracting request token failed")
 	}
 	if tokenStr == "" {
-		http.Error(writer, "no token on request found", 401)
-		return
+		return deny(http.StatusUnauthorized, "no token on request found")
 	}
 
 	// Parse token string
-	token, claims, err := server.stack.ParseToken(tokenStr)
+	token, claims, validatedAt, err := server.stack.ParseTokenValidatedAt(tokenStr)
 	if err != nil {
 		var validationErr *jwt.ValidationError
 		if errors.As(err, &validationErr) {
-			http.Error(writer, "auth token validation failed: "+err.Error(), http.StatusUnauthorized)
+			return deny(http.StatusUnauthorized, "auth token validation failed: "+err.Error())
 		} else {
-			http.Error(writer, "parsing auth token failed:"+err.Error(), http.StatusUnauthorized)
+			return deny(http.StatusUnauthorized, "parsing auth token failed:"+err.Error())
 		}
-		return
 	}
 
 	// Validate the parsed token
 	if !token.Valid {
-		http.Error(writer, "token invalid", 401)
-		return
+		return deny(http.StatusUnauthorized, "token invalid")
 	}
 
 	// Token is trusted from here on
 
-	// Set response headers for proxies etc.
-	header := writer.Header()
+	// Check access rules
+	if rule != nil && !rule.Public {
+		if err := rule.Check(claims); err != nil {
+			return deny(http.StatusForbidden, "insufficient permissions: "+err.Error())
+		}
+	}
+
+	// Set headers for proxies etc.
+	header := http.Header{}
 
-	// Add decoded, claims
-	headers := NewHeader(claims)
-	headers.SetOn(header)
+	// Add decoded claims and token metadata
+	obj := authn.NewJwt(tokenStr, token, claims, source)
+	obj.ValidatedAt = validatedAt
+	headers := NewHeaderFromJwt(obj)
+	if !server.forwardTokens {
+		headers.TokenStr = ""
+	}
+	if err := server.codec.Encode(headers, header); err != nil {
+		return deny(http.StatusInternalServerError, "setting headers failed")
+	}
+
+	if server.emitClaimHeaders {
+		if err := server.codec.EncodeClaimHeaders(claims, server.claimHeaders, header); err != nil {
+			return deny(http.StatusInternalServerError, "setting claim headers failed")
+		}
+	}
+
+	if server.signer != nil {
+		server.codec.Sign(server.signer, header, method, path)
+	}
 
-	writer.WriteHeader(204)
+	return &Decision{Status: http.StatusNoContent, Header: header}
 }
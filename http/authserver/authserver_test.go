@@ -0,0 +1,180 @@
+package authserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DEXPRO-Solutions-GmbH/go-dauth/http/authn"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testSigningKey is the HMAC key used to sign tokens in tests.
+var testSigningKey = []byte("test-signing-key")
+
+// newTestStack returns an authn.AuthStack accepting tokens created by newTestToken.
+func newTestStack(opts ...authn.AuthStackOption) *authn.AuthStack {
+	extractor := authn.NewTokenExtractorChain().
+		Append(authn.NewBearerHeaderTokenExtractor()).
+		Append(authn.NewJwtCookieExtractor(authn.AccessTokenCookieName("test"), nil))
+
+	return authn.NewAuthStack(extractor, func(token *jwt.Token) (interface{}, error) {
+		return testSigningKey, nil
+	}, opts...)
+}
+
+// newTestClaims returns valid claims which may be modified before calling newTestToken.
+func newTestClaims() *authn.Claims {
+	return &authn.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "https://auth.dexpro.de/realms/test",
+			Subject:   "test-user",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(time.Now().Add(-time.Minute)),
+		},
+		TenantId:   uuid.MustParse(testTenantId),
+		TenantName: "test",
+	}
+}
+
+// newTestToken signs the given claims with testSigningKey.
+func newTestToken(t *testing.T, claims *authn.Claims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = "test-key"
+	tokenStr, err := token.SignedString(testSigningKey)
+	require.NoError(t, err)
+	return tokenStr
+}
+
+func serveAuth(server *AuthServer, request *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, request)
+	return rec
+}
+
+func TestAuthServer_ServeHTTP(t *testing.T) {
+	tokenStr := newTestToken(t, newTestClaims())
+
+	newRequest := func(token string) *http.Request {
+		request := httptest.NewRequest("GET", "/auth", nil)
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+		return request
+	}
+
+	t.Run("responds with 401 without token", func(t *testing.T) {
+		rec := serveAuth(NewAuthServer(newTestStack()), newRequest(""))
+		assert.Equal(t, 401, rec.Code)
+	})
+
+	t.Run("responds with 401 for invalid token", func(t *testing.T) {
+		rec := serveAuth(NewAuthServer(newTestStack()), newRequest(tokenStr+"x"))
+		assert.Equal(t, 401, rec.Code)
+	})
+
+	t.Run("responds with 204 and headers for valid token", func(t *testing.T) {
+		rec := serveAuth(NewAuthServer(newTestStack()), newRequest(tokenStr))
+		require.Equal(t, 204, rec.Code)
+
+		header, err := ParseUnsignedHeader(rec.Header())
+		require.NoError(t, err)
+		assert.Equal(t, "test-user", header.Claims.Subject)
+		assert.Equal(t, authn.TokenSourceHeader, header.Source)
+		assert.Equal(t, "test", header.Realm)
+		assert.Equal(t, "test-key", header.KeyId)
+		assert.Empty(t, header.TokenStr, "token must not be forwarded by default")
+	})
+
+	t.Run("forwards token if enabled", func(t *testing.T) {
+		signer := newTestSigner(t, "new")
+		rec := serveAuth(NewAuthServer(newTestStack(), WithTokenForwarding(), WithHeaderSigner(signer)), newRequest(tokenStr))
+		require.Equal(t, 204, rec.Code)
+
+		upstream := httptest.NewRequest("GET", "/auth", nil)
+		upstream.Header = rec.Header()
+		header, err := ParseHeader(upstream, signer)
+		require.NoError(t, err)
+		assert.Equal(t, tokenStr, header.TokenStr)
+
+		obj := header.Jwt()
+		assert.Equal(t, tokenStr, obj.TokenStr)
+		assert.True(t, obj.Token.Valid)
+		assert.Equal(t, "test-key", obj.Token.Header["kid"])
+		assert.Equal(t, "https://auth.dexpro.de/realms/test", obj.Issuer)
+	})
+
+	t.Run("does not trust unsigned headers", func(t *testing.T) {
+		rec := serveAuth(NewAuthServer(newTestStack(), WithTokenForwarding()), newRequest(tokenStr))
+		require.Equal(t, 204, rec.Code)
+
+		header, err := ParseUnsignedHeader(rec.Header())
+		require.NoError(t, err)
+		assert.False(t, header.Verified())
+		assert.False(t, header.Jwt().Token.Valid)
+
+		ctx := SetContextAuthHeader(context.Background(), header)
+		assert.Nil(t, authn.GetCtxJwt(ctx))
+		assert.Nil(t, GetContextJwt(ctx))
+	})
+
+	t.Run("sets claim headers if enabled", func(t *testing.T) {
+		rec := serveAuth(NewAuthServer(newTestStack(), WithClaimHeaders(nil)), newRequest(tokenStr))
+		require.Equal(t, 204, rec.Code)
+		assert.Equal(t, "test-user", rec.Header().Get("Dexp-Authserver-Subject"))
+		assert.NotEmpty(t, rec.Header().Get("Dexp-Authserver-Jwt-Plain"))
+	})
+
+	t.Run("uses configured codec", func(t *testing.T) {
+		codec := NewHeaderCodec(WithHeaderPrefix("Dexp-Portal-"))
+
+		rec := serveAuth(NewAuthServer(newTestStack(), WithHeaderCodec(codec)), newRequest(tokenStr))
+		require.Equal(t, 204, rec.Code)
+		assert.Empty(t, rec.Header().Get("Dexp-Authserver-Jwt-Plain"))
+
+		header, err := codec.DecodeUnsigned(rec.Header())
+		require.NoError(t, err)
+		assert.Equal(t, "test-user", header.Claims.Subject)
+	})
+
+	t.Run("signs headers if enabled", func(t *testing.T) {
+		signer := newTestSigner(t, "new")
+
+		request := newRequest(tokenStr)
+		request.Header.Set("X-Forwarded-Method", "POST")
+		request.Header.Set("X-Forwarded-Uri", "/items")
+
+		rec := serveAuth(NewAuthServer(newTestStack(), WithHeaderSigner(signer)), request)
+		require.Equal(t, 204, rec.Code)
+		assert.NoError(t, signer.Verify(rec.Header(), defaultHeaderPrefix, "POST", "/items"))
+	})
+
+	t.Run("rejects traversal into protected paths", func(t *testing.T) {
+		server := NewAuthServer(newTestStack(), WithAccessRules(
+			AccessRule{Path: "/public/**", Public: true},
+			AccessRule{Path: "/admin/**", Roles: []string{"admin"}},
+		))
+
+		for _, uri := range []string{"/public/../admin/x", "/public/..%2Fadmin/x", "/public/%2e%2e/admin/x"} {
+			request := newRequest("")
+			request.Header.Set("X-Forwarded-Uri", uri)
+			assert.Equal(t, 400, serveAuth(server, request).Code, uri)
+		}
+	})
+
+	t.Run("rejects malformed authorization on public paths", func(t *testing.T) {
+		server := NewAuthServer(newTestStack(), WithAccessRules(AccessRule{Path: "/public/**", Public: true}))
+
+		request := newRequest("")
+		request.Header.Set("X-Forwarded-Uri", "/public/x")
+		assert.Equal(t, 204, serveAuth(server, request).Code)
+
+		request.Header.Set("Authorization", "Bearer")
+		assert.Equal(t, 400, serveAuth(server, request).Code)
+	})
+}
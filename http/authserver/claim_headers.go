@@ -0,0 +1,198 @@
+package authserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/DEXPRO-Solutions-GmbH/go-dauth/http/authn"
+)
+
+// ClaimRoles is a virtual claim name which maps to the realm roles of the "realm_access" claim.
+const ClaimRoles = "roles"
+
+var errMissingClaims = errors.New("missing claims")
+
+// ClaimHeaderMapping maps claim names (as used in the JSON representation of authn.Claims) to header names.
+// Header names are prefixed with the header prefix of the AuthServer.
+//
+// Flat headers are meant for proxies which route or log based on single claims. Only string claims, the time claims
+// "exp", "iat" and "nbf", the audience and ClaimRoles can be parsed back into authn.Claims. List values are joined
+// by commas.
+//
+// Values are kept ASCII-safe by percent-encoding non-ASCII characters, control characters and "%", e.g. "Müller" is
+// sent as "M%C3%BCller". Commas within list items are percent-encoded as well. Plain ASCII values are sent as is.
+type ClaimHeaderMapping map[string]string
+
+// DefaultClaimHeaders is the ClaimHeaderMapping used if no custom mapping is configured.
+var DefaultClaimHeaders = ClaimHeaderMapping{
+	"tenant_id":          "Tenant-Id",
+	"tenant_name":        "Tenant-Name",
+	"sub":                "Subject",
+	"email":              "Email",
+	"preferred_username": "Username",
+	ClaimRoles:           "Roles",
+}
+
+// SetOn sets a header for each mapped claim of the given claims. Empty claims are omitted.
+//
+// Returns ErrHeaderTooLarge if a value exceeds the default header size limit. In that case, header is not modified.
+// Use HeaderCodec.EncodeClaimHeaders for a custom limit.
+func (m ClaimHeaderMapping) SetOn(header http.Header, prefix string, claims *authn.Claims) error {
+	return m.setOn(header, prefix, claims, defaultMaxHeaderSize)
+}
+
+// setOn is like SetOn but uses the given size limit. A limit <= 0 disables the limit.
+func (m ClaimHeaderMapping) setOn(header http.Header, prefix string, claims *authn.Claims, maxSize int) error {
+	encoded, err := json.Marshal(claims)
+	if err != nil {
+		return fmt.Errorf("marshaling claims to json failed: %w", err)
+	}
+
+	var values map[string]any
+	if err := json.Unmarshal(encoded, &values); err != nil {
+		return fmt.Errorf("unmarshaling claims from json failed: %w", err)
+	}
+
+	formatted := map[string]string{}
+	for claim, name := range m {
+		var value any
+		if claim == ClaimRoles {
+			value = claims.RealmAccess["roles"]
+		} else {
+			value = values[claim]
+		}
+
+		str := formatClaimValue(value)
+		if str == "" {
+			continue
+		}
+		if maxSize > 0 && len(str) > maxSize {
+			return fmt.Errorf("%w: %s%s has %d bytes, limit is %d bytes", ErrHeaderTooLarge, prefix, name, len(str), maxSize)
+		}
+		formatted[prefix+name] = str
+	}
+
+	for name, str := range formatted {
+		header.Set(name, str)
+	}
+
+	return nil
+}
+
+// Parse builds claims from the mapped headers. Returns an error if none of the mapped headers is present.
+func (m ClaimHeaderMapping) Parse(header http.Header, prefix string) (*authn.Claims, error) {
+	values := map[string]any{}
+	for claim, name := range m {
+		str := header.Get(prefix + name)
+		if str == "" {
+			continue
+		}
+
+		switch claim {
+		case ClaimRoles:
+			roles, err := splitList(str)
+			if err != nil {
+				return nil, fmt.Errorf("parsing claim '%s' failed", claim)
+			}
+			values["realm_access"] = map[string][]string{"roles": roles}
+		case "aud":
+			audience, err := splitList(str)
+			if err != nil {
+				return nil, fmt.Errorf("parsing claim '%s' failed", claim)
+			}
+			values[claim] = audience
+		case "exp", "iat", "nbf":
+			num, err := strconv.ParseInt(str, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("parsing claim '%s' failed", claim)
+			}
+			values[claim] = num
+		default:
+			unescaped, err := url.PathUnescape(str)
+			if err != nil {
+				return nil, fmt.Errorf("parsing claim '%s' failed", claim)
+			}
+			values[claim] = unescaped
+		}
+	}
+
+	if len(values) == 0 {
+		return nil, errMissingClaims
+	}
+
+	encoded, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims authn.Claims
+	if err := json.Unmarshal(encoded, &claims); err != nil {
+		return nil, errors.New("parsing claims failed")
+	}
+
+	return &claims, nil
+}
+
+func formatClaimValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return escapeClaimValue(v, false)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case []string:
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			parts = append(parts, escapeClaimValue(item, true))
+		}
+		return strings.Join(parts, ",")
+	case []any:
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			if str, ok := item.(string); ok {
+				parts = append(parts, escapeClaimValue(str, true))
+			} else {
+				parts = append(parts, formatClaimValue(item))
+			}
+		}
+		return strings.Join(parts, ",")
+	default:
+		encoded, _ := json.Marshal(v)
+		return escapeClaimValue(string(encoded), false)
+	}
+}
+
+// escapeClaimValue percent-encodes all bytes of str which are not printable ASCII characters and "%". If listItem is
+// set, commas are encoded as well.
+func escapeClaimValue(str string, listItem bool) string {
+	var buf strings.Builder
+	for i := 0; i < len(str); i++ {
+		c := str[i]
+		if c < 0x20 || c >= 0x7f || c == '%' || (listItem && c == ',') {
+			_, _ = fmt.Fprintf(&buf, "%%%02X", c)
+		} else {
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String()
+}
+
+func splitList(str string) ([]string, error) {
+	parts := strings.Split(str, ",")
+	for i := range parts {
+		unescaped, err := url.PathUnescape(strings.TrimSpace(parts[i]))
+		if err != nil {
+			return nil, err
+		}
+		parts[i] = unescaped
+	}
+	return parts, nil
+}
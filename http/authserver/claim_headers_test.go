@@ -0,0 +1,137 @@
+package authserver
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DEXPRO-Solutions-GmbH/go-dauth/http/authn"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClaimHeaderMapping(t *testing.T) {
+	claims := &authn.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "user-1",
+			Audience:  jwt.ClaimStrings{"api", "web"},
+			ExpiresAt: jwt.NewNumericDate(jwt.TimeFunc().Truncate(1e9)),
+		},
+		TenantId:    uuid.MustParse(testTenantId),
+		TenantName:  "test",
+		Email:       "nil@dexpro.de",
+		RealmAccess: map[string][]string{"roles": {"admin", "user"}},
+	}
+
+	t.Run("sets default headers", func(t *testing.T) {
+		header := http.Header{}
+		require.NoError(t, DefaultClaimHeaders.SetOn(header, defaultHeaderPrefix, claims))
+
+		assert.Equal(t, testTenantId, header.Get("Dexp-Authserver-Tenant-Id"))
+		assert.Equal(t, "user-1", header.Get("Dexp-Authserver-Subject"))
+		assert.Equal(t, "nil@dexpro.de", header.Get("Dexp-Authserver-Email"))
+		assert.Equal(t, "admin,user", header.Get("Dexp-Authserver-Roles"))
+		assert.Empty(t, header.Values("Dexp-Authserver-Username"), "empty claims must be omitted")
+	})
+
+	t.Run("round trips custom mapping", func(t *testing.T) {
+		mapping := ClaimHeaderMapping{
+			"sub":       "Sub",
+			"aud":       "Aud",
+			"exp":       "Exp",
+			"tenant_id": "Tenant",
+			ClaimRoles:  "Roles",
+		}
+
+		header := http.Header{}
+		require.NoError(t, mapping.SetOn(header, defaultHeaderPrefix, claims))
+		assert.Equal(t, "api,web", header.Get("Dexp-Authserver-Aud"))
+
+		parsed, err := mapping.Parse(header, defaultHeaderPrefix)
+		require.NoError(t, err)
+		assert.Equal(t, claims.Subject, parsed.Subject)
+		assert.Equal(t, claims.Audience, parsed.Audience)
+		assert.True(t, claims.ExpiresAt.Equal(parsed.ExpiresAt.Time))
+		assert.Equal(t, claims.TenantId, parsed.TenantId)
+		assert.Equal(t, claims.RealmAccess, parsed.RealmAccess)
+	})
+
+	t.Run("encodes non-ASCII values", func(t *testing.T) {
+		claims := &authn.Claims{
+			TenantName:  "Müller 100%",
+			RealmAccess: map[string][]string{"roles": {"a,b", "ß"}},
+		}
+
+		header := http.Header{}
+		require.NoError(t, DefaultClaimHeaders.SetOn(header, defaultHeaderPrefix, claims))
+		assert.Equal(t, "M%C3%BCller 100%25", header.Get("Dexp-Authserver-Tenant-Name"))
+		assert.Equal(t, "a%2Cb,%C3%9F", header.Get("Dexp-Authserver-Roles"))
+		for name, values := range header {
+			for _, value := range values {
+				for _, c := range []byte(value) {
+					assert.True(t, c >= 0x20 && c < 0x7f, "header %s must be ASCII", name)
+				}
+			}
+		}
+
+		parsed, err := DefaultClaimHeaders.Parse(header, defaultHeaderPrefix)
+		require.NoError(t, err)
+		assert.Equal(t, claims.TenantName, parsed.TenantName)
+		assert.Equal(t, claims.RealmAccess, parsed.RealmAccess)
+	})
+
+	t.Run("rejects oversized values", func(t *testing.T) {
+		roles := make([]string, 1000)
+		for i := range roles {
+			roles[i] = fmt.Sprintf("role-%d", i)
+		}
+		claims := &authn.Claims{TenantName: "test", RealmAccess: map[string][]string{"roles": roles}}
+
+		header := http.Header{}
+		err := NewHeaderCodec(WithMaxHeaderSize(1024)).EncodeClaimHeaders(claims, nil, header)
+		assert.ErrorIs(t, err, ErrHeaderTooLarge)
+		assert.Empty(t, header, "no header must be set if any value is too large")
+
+		assert.ErrorIs(t, DefaultClaimHeaders.SetOn(header, defaultHeaderPrefix, claims), ErrHeaderTooLarge)
+	})
+
+	t.Run("parse header accepts signed flat headers", func(t *testing.T) {
+		signer := newTestSigner(t, "new")
+		request := httptest.NewRequest("GET", "/items", nil)
+		require.NoError(t, DefaultClaimHeaders.SetOn(request.Header, defaultHeaderPrefix, claims))
+		signer.Sign(request.Header, defaultHeaderPrefix, "GET", "/items")
+
+		parsed, err := ParseHeader(request, signer)
+		require.NoError(t, err)
+		assert.Equal(t, claims.TenantId, parsed.Claims.TenantId)
+		assert.Equal(t, claims.TenantName, parsed.Claims.TenantName)
+		assert.Equal(t, claims.RealmAccess, parsed.Claims.RealmAccess)
+	})
+
+	t.Run("parse header rejects injected flat headers", func(t *testing.T) {
+		signer := newTestSigner(t, "new")
+		request := httptest.NewRequest("GET", "/items", nil)
+		require.NoError(t, DefaultClaimHeaders.SetOn(request.Header, defaultHeaderPrefix, claims))
+		signer.Sign(request.Header, defaultHeaderPrefix, "GET", "/items")
+		request.Header.Set(defaultHeaderPrefix+"Roles", "admin")
+
+		_, err := ParseHeader(request, signer)
+		assert.ErrorIs(t, err, ErrSignatureInvalid)
+	})
+
+	t.Run("parse unsigned header ignores flat headers", func(t *testing.T) {
+		header := http.Header{}
+		require.NoError(t, DefaultClaimHeaders.SetOn(header, defaultHeaderPrefix, claims))
+
+		_, err := ParseUnsignedHeader(header)
+		assert.Error(t, err)
+	})
+
+	t.Run("parse fails without any claims", func(t *testing.T) {
+		_, err := ParseUnsignedHeader(http.Header{})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,394 @@
+package authserver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/DEXPRO-Solutions-GmbH/go-dauth/http/authn"
+	"github.com/gin-gonic/gin"
+)
+
+// HeaderNames are the names of the headers set by an AuthServer, without prefix.
+type HeaderNames struct {
+	JwtPlain    string
+	TokenSource string
+	Realm       string
+	KeyId       string
+	ValidatedAt string
+	AccessToken string
+}
+
+// DefaultHeaderNames returns the header names used if no custom names are configured.
+func DefaultHeaderNames() HeaderNames {
+	return HeaderNames{
+		JwtPlain:    headerJwtPlain,
+		TokenSource: headerTokenSource,
+		Realm:       headerRealm,
+		KeyId:       headerKeyId,
+		ValidatedAt: headerValidatedAt,
+		AccessToken: headerAccessToken,
+	}
+}
+
+// ClaimsEncoding controls how the JSON claims header value is encoded.
+type ClaimsEncoding int
+
+const (
+	// ClaimsEncodingJSON writes plain JSON. Non-ASCII characters are escaped as JSON unicode escapes, so that
+	// the header value is always ASCII.
+	ClaimsEncodingJSON ClaimsEncoding = iota
+	// ClaimsEncodingBase64 writes base64url encoded JSON without padding.
+	ClaimsEncodingBase64
+	// ClaimsEncodingBase64Gzip writes base64url encoded, gzip compressed JSON without padding. Use this for large
+	// claims, e.g. tokens carrying many roles.
+	ClaimsEncodingBase64Gzip
+)
+
+// defaultMaxHeaderSize is the default limit for single header values. It matches the default header buffer size of
+// nginx.
+const defaultMaxHeaderSize = 8 * 1024
+
+// ErrHeaderTooLarge is returned when encoding a header value which exceeds the size limit of a HeaderCodec.
+var ErrHeaderTooLarge = errors.New("header value too large")
+
+// HeaderCodec encodes a Header to http.Header values and decodes it from them.
+//
+// An AuthServer and the middlewares parsing its headers must share the same codec configuration. Use distinct
+// prefixes to chain multiple auth proxies (e.g. an internal one and a portal one) without header collisions.
+type HeaderCodec struct {
+	prefix        string
+	names         HeaderNames
+	claimHeaders  ClaimHeaderMapping
+	encoding      ClaimsEncoding
+	maxHeaderSize int
+}
+
+// HeaderCodecOption configures optional behaviour of a HeaderCodec.
+type HeaderCodecOption func(codec *HeaderCodec)
+
+// WithHeaderPrefix sets the prefix of all headers, e.g. "Dexp-Portal-Authserver-".
+func WithHeaderPrefix(prefix string) HeaderCodecOption {
+	return func(codec *HeaderCodec) {
+		codec.prefix = prefix
+	}
+}
+
+// WithHeaderNames sets the header names. Empty names are replaced by their default.
+func WithHeaderNames(names HeaderNames) HeaderCodecOption {
+	return func(codec *HeaderCodec) {
+		defaults := DefaultHeaderNames()
+		orDefault := func(name, fallback string) string {
+			if name == "" {
+				return fallback
+			}
+			return name
+		}
+
+		codec.names = HeaderNames{
+			JwtPlain:    orDefault(names.JwtPlain, defaults.JwtPlain),
+			TokenSource: orDefault(names.TokenSource, defaults.TokenSource),
+			Realm:       orDefault(names.Realm, defaults.Realm),
+			KeyId:       orDefault(names.KeyId, defaults.KeyId),
+			ValidatedAt: orDefault(names.ValidatedAt, defaults.ValidatedAt),
+			AccessToken: orDefault(names.AccessToken, defaults.AccessToken),
+		}
+	}
+}
+
+// WithClaimHeaderMapping sets the mapping of flat claim headers. It is used to parse claims of signed headers if the
+// JSON claims header is missing and by AuthServer instances configured with WithClaimHeaders.
+func WithClaimHeaderMapping(mapping ClaimHeaderMapping) HeaderCodecOption {
+	return func(codec *HeaderCodec) {
+		codec.claimHeaders = mapping
+	}
+}
+
+// WithClaimsEncoding sets the encoding of the JSON claims header. Decoding detects the encoding automatically, so
+// the encoding of an AuthServer can be changed without reconfiguring the receiving services.
+func WithClaimsEncoding(encoding ClaimsEncoding) HeaderCodecOption {
+	return func(codec *HeaderCodec) {
+		codec.encoding = encoding
+	}
+}
+
+// WithMaxHeaderSize sets the maximum size in bytes of single header values. Encoding fails with ErrHeaderTooLarge if
+// a value exceeds the limit. A value <= 0 disables the limit.
+func WithMaxHeaderSize(size int) HeaderCodecOption {
+	return func(codec *HeaderCodec) {
+		codec.maxHeaderSize = size
+	}
+}
+
+// defaultHeaderCodec is the codec used by ParseHeader, Header.SetOn and the package level middlewares.
+var defaultHeaderCodec = NewHeaderCodec()
+
+func NewHeaderCodec(opts ...HeaderCodecOption) *HeaderCodec {
+	codec := &HeaderCodec{
+		prefix:        defaultHeaderPrefix,
+		names:         DefaultHeaderNames(),
+		claimHeaders:  DefaultClaimHeaders,
+		encoding:      ClaimsEncodingJSON,
+		maxHeaderSize: defaultMaxHeaderSize,
+	}
+	for _, opt := range opts {
+		opt(codec)
+	}
+	return codec
+}
+
+// Prefix returns the prefix of all headers of this codec.
+func (c *HeaderCodec) Prefix() string {
+	return c.prefix
+}
+
+// Encode sets the given Header on header.
+//
+// Returns an error if the claims cannot be encoded or a value exceeds the size limit. In that case, header is not
+// modified.
+func (c *HeaderCodec) Encode(h *Header, header http.Header) error {
+	claimsStr, err := c.encodeClaims(h.Claims)
+	if err != nil {
+		return err
+	}
+
+	values := map[string]string{
+		c.names.JwtPlain:    claimsStr,
+		c.names.TokenSource: string(h.Source),
+		c.names.Realm:       h.Realm,
+		c.names.KeyId:       h.KeyId,
+		c.names.AccessToken: h.TokenStr,
+	}
+	if !h.ValidatedAt.IsZero() {
+		values[c.names.ValidatedAt] = h.ValidatedAt.UTC().Format(time.RFC3339)
+	}
+
+	for name, value := range values {
+		if err := c.checkSize(name, value); err != nil {
+			return err
+		}
+	}
+	for name, value := range values {
+		if value != "" {
+			header.Set(c.prefix+name, value)
+		}
+	}
+
+	return nil
+}
+
+func (c *HeaderCodec) checkSize(name string, value string) error {
+	if c.maxHeaderSize > 0 && len(value) > c.maxHeaderSize {
+		return fmt.Errorf("%w: %s%s has %d bytes, limit is %d bytes", ErrHeaderTooLarge, c.prefix, name, len(value), c.maxHeaderSize)
+	}
+	return nil
+}
+
+func (c *HeaderCodec) encodeClaims(claims *authn.Claims) (string, error) {
+	encoded, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("marshaling claims to json failed: %w", err)
+	}
+
+	switch c.encoding {
+	case ClaimsEncodingBase64:
+		return base64.RawURLEncoding.EncodeToString(encoded), nil
+	case ClaimsEncodingBase64Gzip:
+		var buf bytes.Buffer
+		writer := gzip.NewWriter(&buf)
+		if _, err := writer.Write(encoded); err != nil {
+			return "", fmt.Errorf("compressing claims failed: %w", err)
+		}
+		if err := writer.Close(); err != nil {
+			return "", fmt.Errorf("compressing claims failed: %w", err)
+		}
+		return base64.RawURLEncoding.EncodeToString(buf.Bytes()), nil
+	default:
+		return escapeNonASCII(encoded), nil
+	}
+}
+
+// escapeNonASCII replaces all non-ASCII characters of the given JSON with JSON unicode escapes. Since json.Marshal
+// only emits non-ASCII characters within strings, the result is equivalent JSON.
+func escapeNonASCII(encoded []byte) string {
+	var buf strings.Builder
+	for _, r := range string(encoded) {
+		if r < utf8.RuneSelf {
+			buf.WriteRune(r)
+			continue
+		}
+
+		if r1, r2 := utf16.EncodeRune(r); r1 != utf8.RuneError {
+			_, _ = fmt.Fprintf(&buf, `\u%04x\u%04x`, r1, r2)
+		} else {
+			_, _ = fmt.Fprintf(&buf, `\u%04x`, r)
+		}
+	}
+	return buf.String()
+}
+
+// decodeClaims parses claims encoded with any ClaimsEncoding.
+func decodeClaims(claimsStr string) (*authn.Claims, error) {
+	encoded := []byte(claimsStr)
+
+	if claimsStr[0] != '{' {
+		decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(claimsStr, "="))
+		if err != nil {
+			return nil, errors.New("decoding claims failed")
+		}
+		encoded = decoded
+
+		// gzip magic number
+		if bytes.HasPrefix(encoded, []byte{0x1f, 0x8b}) {
+			reader, err := gzip.NewReader(bytes.NewReader(encoded))
+			if err != nil {
+				return nil, errors.New("decompressing claims failed")
+			}
+			// Limit decompressed size to prevent decompression bombs
+			encoded, err = io.ReadAll(io.LimitReader(reader, maxDecompressedClaimsSize))
+			if err != nil {
+				return nil, errors.New("decompressing claims failed")
+			}
+		}
+	}
+
+	claims := &authn.Claims{}
+	if err := json.Unmarshal(encoded, claims); err != nil {
+		return nil, errors.New("parsing claims failed")
+	}
+	return claims, nil
+}
+
+// maxDecompressedClaimsSize limits the size of decompressed claims.
+const maxDecompressedClaimsSize = 1024 * 1024
+
+// EncodeClaimHeaders sets the flat claim headers of the given claims on header. If mapping is nil, the mapping of
+// the codec is used.
+//
+// Returns ErrHeaderTooLarge if a value exceeds the size limit of the codec. In that case, header is not modified.
+func (c *HeaderCodec) EncodeClaimHeaders(claims *authn.Claims, mapping ClaimHeaderMapping, header http.Header) error {
+	if mapping == nil {
+		mapping = c.claimHeaders
+	}
+	return mapping.setOn(header, c.prefix, claims, c.maxHeaderSize)
+}
+
+// DecodeUnsigned parses a Header from header without verifying its signature. See ParseUnsignedHeader for when this
+// is acceptable.
+//
+// Claims are only parsed from the JSON header. Flat claim headers are ignored, since proxies forwarding only some of
+// the prefixed headers would otherwise pass client-supplied claims. When parsing, Header.Claims will not be
+// validated but only parsed.
+func (c *HeaderCodec) DecodeUnsigned(header http.Header) (*Header, error) {
+	return c.decode(header, false)
+}
+
+// decode parses a Header from header. If claimHeaders is set, claims are parsed from the flat claim headers if the
+// JSON claims header is missing. This must only be done for headers whose signature has been verified.
+func (c *HeaderCodec) decode(header http.Header, claimHeaders bool) (*Header, error) {
+	claimsStr := header.Get(c.prefix + c.names.JwtPlain)
+
+	var (
+		claims *authn.Claims
+		err    error
+	)
+	switch {
+	case claimsStr != "":
+		claims, err = decodeClaims(claimsStr)
+	case claimHeaders:
+		claims, err = c.claimHeaders.Parse(header, c.prefix)
+	default:
+		err = errMissingClaims
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	h := NewHeader(claims)
+	h.Source = authn.TokenSource(header.Get(c.prefix + c.names.TokenSource))
+	h.Realm = header.Get(c.prefix + c.names.Realm)
+	h.KeyId = header.Get(c.prefix + c.names.KeyId)
+	h.TokenStr = header.Get(c.prefix + c.names.AccessToken)
+
+	if validatedAt := header.Get(c.prefix + c.names.ValidatedAt); validatedAt != "" {
+		t, err := time.Parse(time.RFC3339, validatedAt)
+		if err != nil {
+			return nil, errors.New("parsing validation timestamp failed")
+		}
+		h.ValidatedAt = t
+	}
+
+	return h, nil
+}
+
+// Sign adds a signature over all headers of this codec. See HeaderSigner.
+func (c *HeaderCodec) Sign(signer *HeaderSigner, header http.Header, method string, path string) {
+	signer.Sign(header, c.prefix, method, path)
+}
+
+// DecodeRequest parses a Header from the given request after verifying its signature. Unsigned, tampered or stale
+// headers are rejected. If signer is nil, ErrSignerMissing is returned.
+//
+// Claims are parsed from the JSON header if present. Otherwise, they are parsed from the flat claim headers. Since
+// the signature covers all headers with the prefix of the codec, flat headers added by clients are rejected.
+func (c *HeaderCodec) DecodeRequest(request *http.Request, signer *HeaderSigner) (*Header, error) {
+	if signer == nil {
+		return nil, ErrSignerMissing
+	}
+	if err := signer.Verify(request.Header, c.prefix, request.Method, request.URL.Path); err != nil {
+		return nil, err
+	}
+
+	header, err := c.decode(request.Header, true)
+	if err != nil {
+		return nil, err
+	}
+	header.verified = true
+	return header, nil
+}
+
+// GinMiddleware returns a gin middleware that parses the signed headers of this codec into a Header object and adds
+// it to the request context. See DecodeRequest.
+func (c *HeaderCodec) GinMiddleware(signer *HeaderSigner) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c.handleGin(ctx, signer, true)
+	}
+}
+
+// UnsignedGinMiddleware is like GinMiddleware but does not verify signatures. See ParseUnsignedHeader for when this
+// is acceptable. Flat claim headers are removed from the request, so that handlers cannot read client-supplied claims.
+func (c *HeaderCodec) UnsignedGinMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c.handleGin(ctx, nil, false)
+	}
+}
+
+func (c *HeaderCodec) handleGin(ctx *gin.Context, signer *HeaderSigner, signed bool) {
+	var (
+		header *Header
+		err    error
+	)
+	if signed {
+		header, err = c.DecodeRequest(ctx.Request, signer)
+	} else {
+		header, err = c.DecodeUnsigned(ctx.Request.Header)
+		for _, name := range c.claimHeaders {
+			ctx.Request.Header.Del(c.prefix + name)
+		}
+	}
+	if err != nil {
+		_ = ctx.AbortWithError(headerErrorStatus(err), fmt.Errorf("parsing auth headers failed: %w", err))
+		return
+	}
+
+	SetContextAuthHeader(ctx, header)
+}
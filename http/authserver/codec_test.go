@@ -0,0 +1,128 @@
+package authserver
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DEXPRO-Solutions-GmbH/go-dauth/http/authn"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeaderCodec(t *testing.T) {
+	internal := NewHeaderCodec()
+	portal := NewHeaderCodec(
+		WithHeaderPrefix("Dexp-Portal-"),
+		WithHeaderNames(HeaderNames{JwtPlain: "Claims"}),
+	)
+
+	t.Run("chained codecs do not collide", func(t *testing.T) {
+		header := http.Header{}
+		require.NoError(t, internal.Encode(&Header{Claims: &authn.Claims{TenantName: "internal"}, Realm: "a"}, header))
+		require.NoError(t, portal.Encode(&Header{Claims: &authn.Claims{TenantName: "portal"}, Realm: "b"}, header))
+
+		assert.NotEmpty(t, header.Get("Dexp-Portal-Claims"))
+		assert.Equal(t, "b", header.Get("Dexp-Portal-Realm"))
+
+		internalHeader, err := internal.DecodeUnsigned(header)
+		require.NoError(t, err)
+		assert.Equal(t, "internal", internalHeader.Claims.TenantName)
+		assert.Equal(t, "a", internalHeader.Realm)
+
+		portalHeader, err := portal.DecodeUnsigned(header)
+		require.NoError(t, err)
+		assert.Equal(t, "portal", portalHeader.Claims.TenantName)
+		assert.Equal(t, "b", portalHeader.Realm)
+	})
+
+	t.Run("signatures of chained codecs do not collide", func(t *testing.T) {
+		signer := newTestSigner(t, "new")
+
+		request := httptest.NewRequest("GET", "/items", nil)
+		require.NoError(t, internal.Encode(&Header{Claims: &authn.Claims{TenantName: "internal"}}, request.Header))
+		internal.Sign(signer, request.Header, "GET", "/items")
+		require.NoError(t, portal.Encode(&Header{Claims: &authn.Claims{TenantName: "portal"}}, request.Header))
+		portal.Sign(signer, request.Header, "GET", "/items")
+
+		_, err := internal.DecodeRequest(request, signer)
+		assert.NoError(t, err)
+		_, err = portal.DecodeRequest(request, signer)
+		assert.NoError(t, err)
+	})
+
+	t.Run("gin middleware uses codec", func(t *testing.T) {
+		gin.SetMode(gin.TestMode)
+
+		rec := httptest.NewRecorder()
+		ctx := gin.CreateTestContextOnly(rec, gin.New())
+		ctx.Request = httptest.NewRequest("GET", "/", nil)
+		require.NoError(t, portal.Encode(&Header{Claims: &authn.Claims{TenantName: "portal"}}, ctx.Request.Header))
+
+		portal.UnsignedGinMiddleware()(ctx)
+		require.Equal(t, 200, rec.Code)
+		assert.Equal(t, "portal", MustGetContextAuthClaims(ctx).TenantName)
+	})
+}
+
+func TestHeaderCodec_Encoding(t *testing.T) {
+	claims := &authn.Claims{
+		Name:        "Jürgen Müller 😀",
+		TenantName:  "test",
+		RealmAccess: map[string][]string{"roles": {"admin", "user"}},
+	}
+
+	isASCII := func(str string) bool {
+		for _, r := range str {
+			if r > 127 {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, encoding := range []ClaimsEncoding{ClaimsEncodingJSON, ClaimsEncodingBase64, ClaimsEncodingBase64Gzip} {
+		t.Run(fmt.Sprintf("encoding %d", encoding), func(t *testing.T) {
+			codec := NewHeaderCodec(WithClaimsEncoding(encoding))
+
+			header := http.Header{}
+			require.NoError(t, codec.Encode(NewHeader(claims), header))
+			assert.True(t, isASCII(header.Get(defaultHeaderPrefix+headerJwtPlain)), "header value must be ASCII")
+
+			// decoding detects the encoding, so the default codec must be able to parse it
+			parsed, err := ParseUnsignedHeader(header)
+			require.NoError(t, err)
+			assert.Equal(t, claims.Name, parsed.Claims.Name)
+			assert.Equal(t, claims.RealmAccess, parsed.Claims.RealmAccess)
+		})
+	}
+
+	t.Run("rejects values exceeding the size limit", func(t *testing.T) {
+		roles := make([]string, 1000)
+		for i := range roles {
+			roles[i] = fmt.Sprintf("role-%d", i)
+		}
+		large := &authn.Claims{RealmAccess: map[string][]string{"roles": roles}}
+
+		header := http.Header{}
+		err := NewHeader(large).SetOn(header)
+		assert.ErrorIs(t, err, ErrHeaderTooLarge)
+		assert.Empty(t, header, "header must not be modified on error")
+
+		t.Run("compression helps", func(t *testing.T) {
+			codec := NewHeaderCodec(WithClaimsEncoding(ClaimsEncodingBase64Gzip))
+			assert.NoError(t, codec.Encode(NewHeader(large), http.Header{}))
+		})
+	})
+
+	t.Run("rejects invalid encodings", func(t *testing.T) {
+		header := http.Header{}
+		header.Set(defaultHeaderPrefix+headerJwtPlain, strings.Repeat("!", 10))
+
+		_, err := ParseUnsignedHeader(header)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,6 @@
+// Package extauthz exposes an authserver.AuthServer as Envoy external authorization service
+// (envoy.service.auth.v3.Authorization).
+//
+// This package is separated from authserver so that services which only parse authserver headers do not depend on
+// gRPC and the Envoy API.
+package extauthz
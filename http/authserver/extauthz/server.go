@@ -0,0 +1,151 @@
+package extauthz
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/DEXPRO-Solutions-GmbH/go-dauth/http/authserver"
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	rpcstatus "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Server implements the Envoy external authorization gRPC service based on an authserver.AuthServer.
+//
+// Trusted requests are answered with OK and the headers of the AuthServer are added to the upstream request. Headers
+// with the prefix of the AuthServer's codec which are sent by clients are removed, so that they cannot be spoofed.
+//
+// Untrusted requests are answered with a denied response carrying the status code and message of the AuthServer.
+type Server struct {
+	authv3.UnimplementedAuthorizationServer
+
+	authServer *authserver.AuthServer
+}
+
+func NewServer(authServer *authserver.AuthServer) *Server {
+	return &Server{authServer: authServer}
+}
+
+// Register registers the server on the given gRPC server.
+func (s *Server) Register(registrar grpc.ServiceRegistrar) {
+	authv3.RegisterAuthorizationServer(registrar, s)
+}
+
+func (s *Server) Check(ctx context.Context, checkRequest *authv3.CheckRequest) (*authv3.CheckResponse, error) {
+	attributes := checkRequest.GetAttributes().GetRequest().GetHttp()
+	if attributes == nil {
+		return nil, status.Error(codes.InvalidArgument, "missing http request attributes")
+	}
+
+	request, err := newHttpRequest(ctx, attributes)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid http request attributes: %v", err)
+	}
+
+	decision := s.authServer.Authenticate(request)
+	if !decision.Allowed() {
+		return deniedResponse(decision), nil
+	}
+
+	return &authv3.CheckResponse{
+		Status: &rpcstatus.Status{Code: int32(codes.OK)},
+		HttpResponse: &authv3.CheckResponse_OkResponse{
+			OkResponse: &authv3.OkHttpResponse{
+				Headers:         headerValueOptions(decision.Header),
+				HeadersToRemove: spoofedHeaders(request.Header, decision.Header, s.authServer.HeaderCodec().Prefix()),
+			},
+		},
+	}, nil
+}
+
+// forwardedRequestHeaders are the headers used by forward-auth proxies to pass the original request to an
+// authserver.AuthServer.
+var forwardedRequestHeaders = []string{"X-Forwarded-Method", "X-Original-Method", "X-Forwarded-Uri", "X-Original-Uri"}
+
+// newHttpRequest converts the request attributes sent by Envoy to a http.Request.
+func newHttpRequest(ctx context.Context, attributes *authv3.AttributeContext_HttpRequest) (*http.Request, error) {
+	scheme := attributes.GetScheme()
+	if scheme == "" {
+		scheme = "http"
+	}
+
+	target, err := url.ParseRequestURI(attributes.GetPath())
+	if err != nil {
+		return nil, err
+	}
+	target.Scheme = scheme
+	target.Host = attributes.GetHost()
+
+	request, err := http.NewRequestWithContext(ctx, attributes.GetMethod(), target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, value := range attributes.GetHeaders() {
+		// Skip HTTP/2 pseudo headers like ":authority"
+		if strings.HasPrefix(name, ":") {
+			continue
+		}
+		request.Header.Set(name, value)
+	}
+
+	// Envoy passes the original method and path, headers of forward-auth proxies are set by the client
+	for _, name := range forwardedRequestHeaders {
+		request.Header.Del(name)
+	}
+
+	return request, nil
+}
+
+func deniedResponse(decision *authserver.Decision) *authv3.CheckResponse {
+	code := codes.PermissionDenied
+	if decision.Status == http.StatusUnauthorized {
+		code = codes.Unauthenticated
+	}
+
+	return &authv3.CheckResponse{
+		Status: &rpcstatus.Status{Code: int32(code), Message: decision.Message},
+		HttpResponse: &authv3.CheckResponse_DeniedResponse{
+			DeniedResponse: &authv3.DeniedHttpResponse{
+				Status:  &typev3.HttpStatus{Code: typev3.StatusCode(decision.Status)},
+				Headers: headerValueOptions(decision.Header),
+				Body:    decision.Message,
+			},
+		},
+	}
+}
+
+func headerValueOptions(header http.Header) []*corev3.HeaderValueOption {
+	var options []*corev3.HeaderValueOption
+	for name, values := range header {
+		for _, value := range values {
+			options = append(options, &corev3.HeaderValueOption{
+				Header:       &corev3.HeaderValue{Key: name, Value: value},
+				AppendAction: corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
+			})
+		}
+	}
+	return options
+}
+
+// spoofedHeaders returns the names of all request headers with the given prefix which are not set by the AuthServer.
+func spoofedHeaders(requestHeader http.Header, authHeader http.Header, prefix string) []string {
+	canonicalPrefix := http.CanonicalHeaderKey(prefix)
+
+	var names []string
+	for name := range requestHeader {
+		if !strings.HasPrefix(name, canonicalPrefix) {
+			continue
+		}
+		if _, ok := authHeader[name]; !ok {
+			names = append(names, strings.ToLower(name))
+		}
+	}
+	return names
+}
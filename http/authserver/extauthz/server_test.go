@@ -0,0 +1,151 @@
+package extauthz
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/DEXPRO-Solutions-GmbH/go-dauth/http/authn"
+	"github.com/DEXPRO-Solutions-GmbH/go-dauth/http/authserver"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+var testSigningKey = []byte("test-signing-key")
+
+func newTestToken(t *testing.T) string {
+	claims := &authn.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "https://auth.dexpro.de/realms/test",
+			Subject:   "test-user",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(time.Now().Add(-time.Minute)),
+		},
+		TenantId:   uuid.New(),
+		TenantName: "test",
+	}
+
+	tokenStr, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(testSigningKey)
+	require.NoError(t, err)
+	return tokenStr
+}
+
+// newTestClient starts an in-process gRPC server and returns a client connected to it.
+func newTestClient(t *testing.T) authv3.AuthorizationClient {
+	stack := authn.NewAuthStack(
+		authn.NewTokenExtractorChain().Append(authn.NewBearerHeaderTokenExtractor()),
+		func(token *jwt.Token) (interface{}, error) {
+			return testSigningKey, nil
+		},
+	)
+
+	listener := bufconn.Listen(1024 * 1024)
+	grpcServer := grpc.NewServer()
+	NewServer(authserver.NewAuthServer(stack)).Register(grpcServer)
+	go func() {
+		_ = grpcServer.Serve(listener)
+	}()
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	return authv3.NewAuthorizationClient(conn)
+}
+
+func newCheckRequest(headers map[string]string) *authv3.CheckRequest {
+	return &authv3.CheckRequest{
+		Attributes: &authv3.AttributeContext{
+			Request: &authv3.AttributeContext_Request{
+				Http: &authv3.AttributeContext_HttpRequest{
+					Method:  "GET",
+					Path:    "/items?page=1",
+					Host:    "api.dexpro.de",
+					Scheme:  "https",
+					Headers: headers,
+				},
+			},
+		},
+	}
+}
+
+func TestServer_Check(t *testing.T) {
+	client := newTestClient(t)
+
+	t.Run("denies request without token", func(t *testing.T) {
+		response, err := client.Check(context.Background(), newCheckRequest(nil))
+		require.NoError(t, err)
+		assert.Equal(t, int32(codes.Unauthenticated), response.GetStatus().GetCode())
+		assert.Equal(t, int32(401), int32(response.GetDeniedResponse().GetStatus().GetCode()))
+	})
+
+	t.Run("denies request with malformed header", func(t *testing.T) {
+		response, err := client.Check(context.Background(), newCheckRequest(map[string]string{
+			"authorization": "Basic dXNlcjpwYXNz",
+		}))
+		require.NoError(t, err)
+		assert.Equal(t, int32(400), int32(response.GetDeniedResponse().GetStatus().GetCode()))
+	})
+
+	t.Run("allows request with valid token", func(t *testing.T) {
+		response, err := client.Check(context.Background(), newCheckRequest(map[string]string{
+			":authority":                   "api.dexpro.de",
+			"authorization":                "Bearer " + newTestToken(t),
+			"dexp-authserver-access-token": "spoofed",
+		}))
+		require.NoError(t, err)
+		require.Equal(t, int32(codes.OK), response.GetStatus().GetCode())
+
+		okResponse := response.GetOkResponse()
+		require.NotNil(t, okResponse)
+
+		headers := map[string]string{}
+		for _, option := range okResponse.GetHeaders() {
+			headers[option.GetHeader().GetKey()] = option.GetHeader().GetValue()
+		}
+		assert.NotEmpty(t, headers["Dexp-Authserver-Jwt-Plain"])
+		assert.Equal(t, "test", headers["Dexp-Authserver-Realm"])
+		assert.Equal(t, []string{"dexp-authserver-access-token"}, okResponse.GetHeadersToRemove())
+	})
+
+	t.Run("rejects request without attributes", func(t *testing.T) {
+		_, err := client.Check(context.Background(), &authv3.CheckRequest{})
+		assert.Error(t, err)
+	})
+}
+
+func TestNewHttpRequest(t *testing.T) {
+	t.Run("ignores forwarded headers of client", func(t *testing.T) {
+		attributes := newCheckRequest(map[string]string{
+			"x-forwarded-method": "GET",
+			"x-forwarded-uri":    "/public/x",
+			"x-original-uri":     "/public/x",
+		}).GetAttributes().GetRequest().GetHttp()
+		attributes.Method = "POST"
+		attributes.Path = "/admin/x"
+
+		request, err := newHttpRequest(context.Background(), attributes)
+		require.NoError(t, err)
+		assert.Equal(t, "POST", request.Method)
+		assert.Equal(t, "/admin/x", request.URL.Path)
+		assert.Empty(t, request.Header.Get("X-Forwarded-Method"))
+		assert.Empty(t, request.Header.Get("X-Forwarded-Uri"))
+		assert.Empty(t, request.Header.Get("X-Original-Uri"))
+	})
+}
@@ -0,0 +1,109 @@
+package authserver
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// ErrInvalidPath is returned for original request paths which are not in canonical form.
+var ErrInvalidPath = errors.New("invalid request path")
+
+// originalRequest returns the method and path of the request an AuthServer has been asked to authenticate.
+//
+// Forward-auth proxies like nginx (auth_request) and Traefik (ForwardAuth) pass the original method and URI via
+// dedicated headers. If these headers are missing, the method and path of the given request are used.
+//
+// Since proxies pass the raw URI, the path may differ from the path the upstream service eventually serves, e.g.
+// "/public/..%2Fadmin" is served as "/admin". Paths which are not in canonical form are therefore rejected with
+// ErrInvalidPath instead of being matched against AccessRules. See canonicalPath.
+func originalRequest(request *http.Request) (method string, path string, err error) {
+	method = firstHeader(request.Header, "X-Forwarded-Method", "X-Original-Method")
+	if method == "" {
+		method = request.Method
+	}
+
+	target := request.URL
+	if uri := firstHeader(request.Header, "X-Forwarded-Uri", "X-Original-Uri"); uri != "" {
+		if target, err = url.ParseRequestURI(uri); err != nil {
+			return "", "", ErrInvalidPath
+		}
+	}
+
+	path, err = canonicalPath(target)
+	if err != nil {
+		return "", "", err
+	}
+	return method, path, nil
+}
+
+// canonicalPath returns the decoded path of the given URL. Returns ErrInvalidPath if the path contains dot segments,
+// empty segments, encoded slashes or backslashes, or is not absolute.
+func canonicalPath(target *url.URL) (string, error) {
+	escaped := strings.ToLower(target.EscapedPath())
+	if strings.Contains(escaped, "%2f") || strings.Contains(escaped, "%5c") {
+		return "", ErrInvalidPath
+	}
+
+	decoded := target.Path
+	if !strings.HasPrefix(decoded, "/") || strings.Contains(decoded, "\\") {
+		return "", ErrInvalidPath
+	}
+
+	// Clean removes a trailing slash, which is kept by services serving directories
+	cleaned := path.Clean(decoded)
+	if cleaned != decoded && cleaned+"/" != decoded {
+		return "", ErrInvalidPath
+	}
+
+	return decoded, nil
+}
+
+// originalURL returns the absolute URL of the request an AuthServer has been asked to authenticate.
+//
+// The URL is taken from the X-Original-Url header if present. Otherwise, it is built from the X-Forwarded-Proto,
+// X-Forwarded-Host and X-Forwarded-Uri headers, falling back to the given request.
+//
+// Note that these headers are not validated by proxies. Callers must check the host of the returned URL before
+// redirecting to it.
+func originalURL(request *http.Request) (*url.URL, error) {
+	if value := request.Header.Get("X-Original-Url"); value != "" {
+		return url.Parse(value)
+	}
+
+	scheme := firstHeader(request.Header, "X-Forwarded-Proto")
+	if scheme == "" {
+		switch {
+		case request.URL.Scheme != "":
+			scheme = request.URL.Scheme
+		case request.TLS != nil:
+			scheme = "https"
+		default:
+			scheme = "http"
+		}
+	}
+
+	host := firstHeader(request.Header, "X-Forwarded-Host")
+	if host == "" {
+		host = request.Host
+	}
+
+	uri := firstHeader(request.Header, "X-Forwarded-Uri", "X-Original-Uri")
+	if uri == "" {
+		uri = request.URL.RequestURI()
+	}
+
+	return url.Parse(scheme + "://" + host + uri)
+}
+
+// firstHeader returns the first non-empty value of the given headers.
+func firstHeader(header http.Header, names ...string) string {
+	for _, name := range names {
+		if value := header.Get(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
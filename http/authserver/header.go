@@ -1,56 +1,121 @@
 package authserver
 
 import (
-	"encoding/json"
-	"errors"
-	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/DEXPRO-Solutions-GmbH/go-dauth/http/authn"
+	"github.com/golang-jwt/jwt/v4"
 )
 
 const (
 	// defaultHeaderPrefix is used to prefix all headers set by AuthServer
 	defaultHeaderPrefix = "Dexp-Authserver-"
 	headerJwtPlain      = "Jwt-Plain"
+	headerTokenSource   = "Token-Source"
+	headerRealm         = "Realm"
+	headerKeyId         = "Key-Id"
+	headerValidatedAt   = "Validated-At"
+	headerAccessToken   = "Access-Token"
 )
 
 // Header are the headers set by an AuthServer after a request has successfully been authenticated.
 type Header struct {
 	Claims *authn.Claims
+
+	// Source, Realm, KeyId and ValidatedAt carry the metadata of authn.Jwt. These values are optional and may be
+	// empty if the AuthServer did not set them.
+	Source      authn.TokenSource
+	Realm       string
+	KeyId       string
+	ValidatedAt time.Time
+
+	// TokenStr is the original access token. It is only set if the AuthServer has been configured to forward tokens
+	// via WithTokenForwarding.
+	TokenStr string
+
+	// verified is set if the header has been parsed from headers with a valid signature, see ParseHeader.
+	verified bool
 }
 
 func NewHeader(claims *authn.Claims) *Header {
 	return &Header{Claims: claims}
 }
 
-// ParseHeader takes a http.Header and tries to parse Header from it. Use this function if you receive requests
-// that are being authenticated by an AuthServer.
-//
-// This will return an error if any non-optional header are missing.
+// NewHeaderFromJwt creates a Header carrying the claims and metadata of the given authn.Jwt.
+func NewHeaderFromJwt(obj *authn.Jwt) *Header {
+	return &Header{
+		Claims:      obj.Claims,
+		Source:      obj.Source,
+		Realm:       obj.Realm,
+		KeyId:       obj.KeyId,
+		ValidatedAt: obj.ValidatedAt,
+		TokenStr:    obj.TokenStr,
+	}
+}
+
+// Verified reports whether the signature of the headers this Header has been parsed from has been verified. Headers
+// parsed via ParseUnsignedHeader or created by other means are never verified.
+func (h *Header) Verified() bool {
+	return h.verified
+}
+
+// Jwt converts the header to an authn.Jwt, so that services behind an AuthServer are able to use the same types as
+// services using authn.JwtMiddleware.
 //
-// When parsing, Header.Claims will not be validated but only parsed.
-func ParseHeader(from http.Header) (*Header, error) {
-	headerPrefix := defaultHeaderPrefix
-	claimsStr := from.Get(fmt.Sprintf("%s%s", headerPrefix, headerJwtPlain))
+// The returned token is only marked as valid if the header has been verified, since the AuthServer validated the
+// token in that case. If no token has been forwarded, the returned token only holds the claims.
+func (h *Header) Jwt() *authn.Jwt {
+	obj := &authn.Jwt{
+		TokenStr:    h.TokenStr,
+		Token:       &jwt.Token{Raw: h.TokenStr, Claims: h.Claims, Valid: h.verified},
+		Claims:      h.Claims,
+		Source:      h.Source,
+		Realm:       h.Realm,
+		KeyId:       h.KeyId,
+		ValidatedAt: h.ValidatedAt,
+	}
 
-	if claimsStr == "" {
-		return nil, errors.New("missing jwt plain")
+	if h.Claims != nil {
+		obj.Issuer = h.Claims.Issuer
 	}
 
-	var claims authn.Claims
-	if err := json.Unmarshal([]byte(claimsStr), &claims); err != nil {
-		return nil, errors.New("parsing claims failed")
+	if h.TokenStr != "" {
+		if token, _, err := jwt.NewParser().ParseUnverified(h.TokenStr, &authn.Claims{}); err == nil {
+			obj.Token.Method = token.Method
+			obj.Token.Header = token.Header
+			obj.Token.Signature = token.Signature
+		}
 	}
 
-	return NewHeader(&claims), nil
+	return obj
 }
 
-func (h *Header) SetOn(header http.Header) {
-	headerPrefix := defaultHeaderPrefix
-	claimsStr, err := json.Marshal(h.Claims)
-	if err != nil {
-		panic(fmt.Errorf("marshaling claims to json failed: %v", err))
-	}
-	header.Set(fmt.Sprintf("%s%s", headerPrefix, headerJwtPlain), string(claimsStr))
+// ParseHeader parses a Header from the given request after verifying the signature added by an AuthServer
+// configured with WithHeaderSigner. Use this function if you receive requests that are being authenticated by an
+// AuthServer.
+//
+// Unsigned, tampered or stale headers are rejected. If signer is nil, ErrSignerMissing is returned, so that a missing
+// configuration never results in trusting client-supplied headers.
+//
+// This will return an error if any non-optional header are missing. When parsing, Header.Claims will not be
+// validated but only parsed. Use HeaderCodec.DecodeRequest for custom header names.
+func ParseHeader(request *http.Request, signer *HeaderSigner) (*Header, error) {
+	return defaultHeaderCodec.DecodeRequest(request, signer)
+}
+
+// ParseUnsignedHeader is like ParseHeader but does not verify signatures. Headers sent by clients are therefore
+// trusted as if they had been set by an AuthServer.
+//
+// Only use this if the service is unreachable except through a proxy which removes all headers with the AuthServer
+// prefix from client requests. Flat claim headers are not parsed, see HeaderCodec.DecodeUnsigned.
+func ParseUnsignedHeader(from http.Header) (*Header, error) {
+	return defaultHeaderCodec.DecodeUnsigned(from)
+}
+
+// SetOn sets the headers using the default header names. Use HeaderCodec.Encode for custom header names.
+//
+// Returns an error if the claims cannot be encoded or exceed the header size limit.
+func (h *Header) SetOn(header http.Header) error {
+	return defaultHeaderCodec.Encode(h, header)
 }
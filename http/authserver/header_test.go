@@ -0,0 +1,50 @@
+package authserver
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/DEXPRO-Solutions-GmbH/go-dauth/http/authn"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeader_RoundTrip(t *testing.T) {
+	t.Run("with metadata", func(t *testing.T) {
+		validatedAt := time.Now().Truncate(time.Second)
+		expected := &Header{
+			Claims: &authn.Claims{
+				TenantId:   uuid.MustParse(testTenantId),
+				TenantName: "test",
+			},
+			Source:      authn.TokenSourceCookie,
+			Realm:       "customer",
+			KeyId:       "key-1",
+			ValidatedAt: validatedAt,
+		}
+
+		header := http.Header{}
+		require.NoError(t, expected.SetOn(header))
+
+		actual, err := ParseUnsignedHeader(header)
+		require.NoError(t, err)
+		assert.Equal(t, expected.Claims.TenantId, actual.Claims.TenantId)
+		assert.Equal(t, expected.Source, actual.Source)
+		assert.Equal(t, expected.Realm, actual.Realm)
+		assert.Equal(t, expected.KeyId, actual.KeyId)
+		assert.True(t, expected.ValidatedAt.Equal(actual.ValidatedAt))
+	})
+
+	t.Run("without metadata", func(t *testing.T) {
+		header := http.Header{}
+		require.NoError(t, NewHeader(&authn.Claims{TenantName: "test"}).SetOn(header))
+
+		actual, err := ParseUnsignedHeader(header)
+		require.NoError(t, err)
+		assert.Equal(t, "test", actual.Claims.TenantName)
+		assert.Empty(t, actual.Source)
+		assert.True(t, actual.ValidatedAt.IsZero())
+	})
+}
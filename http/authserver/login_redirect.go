@@ -0,0 +1,138 @@
+package authserver
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var errRedirectNotAllowed = errors.New("original url not allowed for redirects")
+
+// LoginURLResolver resolves the absolute URL of the login endpoint of the authn.LoginHandler users of the given
+// original URL log in at. Since each LoginHandler is bound to a single realm, this selects the realm. Returns false if
+// no login is known for the original URL.
+type LoginURLResolver func(original *url.URL) (loginURL string, ok bool)
+
+// StaticLoginURL returns a LoginURLResolver which always resolves the given login URL, e.g.
+// "https://app.example.com/auth/login".
+func StaticLoginURL(loginURL string) LoginURLResolver {
+	return func(original *url.URL) (string, bool) {
+		return loginURL, true
+	}
+}
+
+// HostLoginURLs returns a LoginURLResolver which resolves login URLs by the host of the original URL, e.g.
+// "acme.example.com" to "https://acme.example.com/auth/login" of a LoginHandler of the realm "acme".
+func HostLoginURLs(loginURLs map[string]string) LoginURLResolver {
+	normalized := make(map[string]string, len(loginURLs))
+	for host, loginURL := range loginURLs {
+		normalized[strings.ToLower(host)] = loginURL
+	}
+
+	return func(original *url.URL) (string, bool) {
+		loginURL, ok := normalized[strings.ToLower(original.Host)]
+		return loginURL, ok
+	}
+}
+
+// LoginRedirect configures an AuthServer to redirect browsers without a valid token to the login endpoint of an
+// authn.LoginHandler instead of responding with a status 401. See WithLoginRedirect.
+type LoginRedirect struct {
+	// LoginURL resolves the login endpoint for the original URL. The original URL is passed to it in the "rd"
+	// parameter.
+	LoginURL LoginURLResolver
+	// AllowedHosts are the hosts of original URLs which are redirected in addition to the host of the resolved login
+	// URL. The LoginHandler must allow the same hosts, see authn.WithAllowedRedirectHosts. Requests for other hosts
+	// are responded with a status 401.
+	AllowedHosts []string
+}
+
+// WithLoginRedirect makes the AuthServer respond with a redirect to the login endpoint if a request without a valid
+// token accepts HTML. API requests are still responded with a status 401.
+//
+// Note that nginx does not pass redirects of auth_request endpoints to clients. Use Traefik or an error_page
+// directive in that case.
+func WithLoginRedirect(redirect *LoginRedirect) AuthServerOption {
+	return func(server *AuthServer) {
+		server.loginRedirect = redirect
+	}
+}
+
+// redirect returns a redirect decision to the login for the given request or nil if the request must not be
+// redirected.
+func (r *LoginRedirect) redirect(request *http.Request) *Decision {
+	method, _, err := originalRequest(request)
+	if err != nil || method != http.MethodGet && method != http.MethodHead {
+		return nil
+	}
+	if !acceptsHTML(request) {
+		return nil
+	}
+
+	original, err := originalURL(request)
+	if err != nil {
+		return nil
+	}
+
+	loginURL, ok := r.LoginURL(original)
+	if !ok {
+		return nil
+	}
+	login, err := url.Parse(loginURL)
+	if err != nil || !login.IsAbs() {
+		return nil
+	}
+
+	redirect, err := r.redirectURL(original, login)
+	if err != nil {
+		return nil
+	}
+
+	query := login.Query()
+	query.Set("rd", redirect)
+	login.RawQuery = query.Encode()
+
+	decision := &Decision{Status: http.StatusFound, Message: "login required", Header: http.Header{}}
+	decision.Header.Set("Location", login.String())
+	return decision
+}
+
+// redirectURL returns the URL users are redirected to after the login. URLs on the host of the login endpoint are
+// returned relative to it, which is accepted by every LoginHandler.
+func (r *LoginRedirect) redirectURL(original *url.URL, login *url.URL) (string, error) {
+	if original.Scheme != "http" && original.Scheme != "https" || original.User != nil || original.Fragment != "" {
+		return "", errRedirectNotAllowed
+	}
+	if _, err := canonicalPath(original); err != nil {
+		return "", err
+	}
+
+	host := strings.ToLower(original.Host)
+	if host == strings.ToLower(login.Host) {
+		return original.RequestURI(), nil
+	}
+	for _, allowed := range r.AllowedHosts {
+		if host == strings.ToLower(allowed) {
+			return original.String(), nil
+		}
+	}
+	return "", errRedirectNotAllowed
+}
+
+// acceptsHTML reports whether the Accept header of the request contains an HTML media type.
+func acceptsHTML(request *http.Request) bool {
+	for _, value := range request.Header.Values("Accept") {
+		for _, part := range strings.Split(value, ",") {
+			mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil {
+				continue
+			}
+			if mediaType == "text/html" || mediaType == "application/xhtml+xml" {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+package authserver
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthServer_LoginRedirect(t *testing.T) {
+	server := NewAuthServer(newTestStack(), WithLoginRedirect(&LoginRedirect{
+		LoginURL:     StaticLoginURL("https://acme.example.com/auth/login"),
+		AllowedHosts: []string{"shop.example.com"},
+	}))
+
+	newRequest := func(accept string, host string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("GET", "/auth", nil)
+		request.Header.Set("Accept", accept)
+		request.Header.Set("X-Forwarded-Proto", "https")
+		request.Header.Set("X-Forwarded-Host", host)
+		request.Header.Set("X-Forwarded-Uri", "/items?page=2")
+		return serveAuth(server, request)
+	}
+
+	t.Run("redirects browsers to login", func(t *testing.T) {
+		rec := newRequest("text/html,application/xhtml+xml;q=0.9,*/*;q=0.8", "acme.example.com")
+		require.Equal(t, 302, rec.Code)
+
+		location, err := url.Parse(rec.Header().Get("Location"))
+		require.NoError(t, err)
+		assert.Equal(t, "https://acme.example.com/auth/login", location.Scheme+"://"+location.Host+location.Path)
+		assert.Equal(t, "/items?page=2", location.Query().Get("rd"))
+	})
+
+	t.Run("passes absolute urls of allowed hosts", func(t *testing.T) {
+		rec := newRequest("text/html", "shop.example.com")
+		require.Equal(t, 302, rec.Code)
+
+		location, err := url.Parse(rec.Header().Get("Location"))
+		require.NoError(t, err)
+		assert.Equal(t, "https://shop.example.com/items?page=2", location.Query().Get("rd"))
+	})
+
+	t.Run("responds 401 for hosts not allowed", func(t *testing.T) {
+		rec := newRequest("text/html", "evil.com")
+		assert.Equal(t, 401, rec.Code)
+		assert.Empty(t, rec.Header().Get("Location"))
+	})
+
+	t.Run("responds 401 for original urls not allowed", func(t *testing.T) {
+		for _, value := range []string{
+			"https://evil.com/items",
+			"https://user@shop.example.com/items",
+			"javascript://shop.example.com/items",
+			"/items",
+		} {
+			request := httptest.NewRequest("GET", "/auth", nil)
+			request.Header.Set("Accept", "text/html")
+			request.Header.Set("X-Original-Url", value)
+			assert.Equal(t, 401, serveAuth(server, request).Code, value)
+		}
+	})
+
+	t.Run("responds 401 to api requests", func(t *testing.T) {
+		rec := newRequest("application/json", "acme.example.com")
+		assert.Equal(t, 401, rec.Code)
+		assert.Empty(t, rec.Header().Get("Location"))
+	})
+
+	t.Run("responds 401 to unsafe methods", func(t *testing.T) {
+		request := httptest.NewRequest("GET", "/auth", nil)
+		request.Header.Set("Accept", "text/html")
+		request.Header.Set("X-Forwarded-Host", "acme.example.com")
+		request.Header.Set("X-Forwarded-Method", "POST")
+		assert.Equal(t, 401, serveAuth(server, request).Code)
+	})
+
+	t.Run("does not redirect with valid token", func(t *testing.T) {
+		request := httptest.NewRequest("GET", "/auth", nil)
+		request.Header.Set("Accept", "text/html")
+		request.Header.Set("Authorization", "Bearer "+newTestToken(t, newTestClaims()))
+		assert.Equal(t, 204, serveAuth(server, request).Code)
+	})
+}
+
+func TestAuthServer_LoginRedirect_HostLoginURLs(t *testing.T) {
+	server := NewAuthServer(newTestStack(), WithLoginRedirect(&LoginRedirect{
+		LoginURL: HostLoginURLs(map[string]string{
+			"acme.example.com":  "https://acme.example.com/auth/login",
+			"Other.example.com": "https://other.example.com/auth/login",
+		}),
+	}))
+
+	redirect := func(host string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("GET", "/auth", nil)
+		request.Header.Set("Accept", "text/html")
+		request.Header.Set("X-Forwarded-Proto", "https")
+		request.Header.Set("X-Forwarded-Host", host)
+		request.Header.Set("X-Forwarded-Uri", "/items")
+		return serveAuth(server, request)
+	}
+
+	for _, host := range []string{"acme.example.com", "other.example.com"} {
+		t.Run("redirects "+host+" to its login", func(t *testing.T) {
+			rec := redirect(host)
+			require.Equal(t, 302, rec.Code)
+
+			location, err := url.Parse(rec.Header().Get("Location"))
+			require.NoError(t, err)
+			assert.Equal(t, host, location.Host)
+			assert.Equal(t, "/auth/login", location.Path)
+			assert.Equal(t, "/items", location.Query().Get("rd"))
+		})
+	}
+
+	t.Run("responds 401 for unknown hosts", func(t *testing.T) {
+		assert.Equal(t, 401, redirect("evil.com").Code)
+	})
+}
+
+func TestOriginalURL(t *testing.T) {
+	t.Run("uses original url header", func(t *testing.T) {
+		request := httptest.NewRequest("GET", "/auth", nil)
+		request.Header.Set("X-Original-Url", "https://example.com/a?b=c")
+
+		original, err := originalURL(request)
+		require.NoError(t, err)
+		assert.Equal(t, "https://example.com/a?b=c", original.String())
+	})
+
+	t.Run("falls back to request", func(t *testing.T) {
+		request := httptest.NewRequest("GET", "/auth?x=y", nil)
+
+		original, err := originalURL(request)
+		require.NoError(t, err)
+		assert.Equal(t, "http://example.com/auth?x=y", original.String())
+	})
+}
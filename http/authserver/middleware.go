@@ -2,6 +2,7 @@ package authserver
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 
@@ -49,25 +50,49 @@ func MustGetContextAuthClaims(ctx context.Context) *authn.Claims {
 	return header.Claims
 }
 
+// GetContextJwt returns the authn.Jwt equivalent of the verified Header on the given context. See Header.Jwt.
+//
+// Returns nil if no value is found or the header has not been verified.
+func GetContextJwt(ctx context.Context) *authn.Jwt {
+	if obj := authn.GetCtxJwt(ctx); obj != nil {
+		return obj
+	}
+
+	header := GetContextAuthHeader(ctx)
+	if header == nil || !header.Verified() {
+		return nil
+	}
+	return header.Jwt()
+}
+
+// SetContextAuthHeader adds the header to the given context. If the header has been verified, its authn.Jwt
+// equivalent is added as well, so that authn.GetCtxJwt can be used by consumers of this package.
 func SetContextAuthHeader(ctx context.Context, header *Header) context.Context {
 	if ginCtx, ok := ctx.(*gin.Context); ok {
 		ginCtx.Set(ctxKeyHeader, header)
+		if header.Verified() {
+			authn.SetCtxJwtGin(ginCtx, header.Jwt())
+		}
 		return ginCtx
 	}
 
-	return context.WithValue(ctx, ctxKeyHeader, header)
+	ctx = context.WithValue(ctx, ctxKeyHeader, header)
+	if header.Verified() {
+		ctx = authn.SetCtxJwt(ctx, header.Jwt())
+	}
+	return ctx
 }
 
-// NewHeaderParserMiddleware returns a middleware that parses the auth headers into a Header object and adds it to the request
-// context. Use GetContextAuthHeader to retrieve the parsed header from the context.
+// NewHeaderParserMiddleware returns a middleware that parses the signed auth headers into a Header object and adds it
+// to the request context. Use GetContextAuthHeader to retrieve the parsed header from the context. See ParseHeader.
 //
 // Deprecated: We generally want to use gin as our web framework. Maintaining both middlewares
 // means more work. Please migrate towards GinHeaderParserMiddleware.
-func NewHeaderParserMiddleware(next http.Handler) http.Handler {
+func NewHeaderParserMiddleware(signer *HeaderSigner, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
-		header, err := ParseHeader(request.Header)
+		header, err := ParseHeader(request, signer)
 		if err != nil {
-			http.Error(writer, fmt.Sprintf("parsing auth headers failed: %s", err), http.StatusUnauthorized)
+			http.Error(writer, fmt.Sprintf("parsing auth headers failed: %s", err), headerErrorStatus(err))
 			return
 		}
 
@@ -76,13 +101,25 @@ func NewHeaderParserMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-// GinHeaderParserMiddleware is a gin middleware that behaves like the middleware returned from NewHeaderParserMiddleware.
-func GinHeaderParserMiddleware(ctx *gin.Context) {
-	header, err := ParseHeader(ctx.Request.Header)
-	if err != nil {
-		_ = ctx.AbortWithError(http.StatusUnauthorized, fmt.Errorf("parsing auth headers failed: %w", err))
-		return
-	}
+// GinHeaderParserMiddleware returns a gin middleware that behaves like the middleware returned from
+// NewHeaderParserMiddleware. Only headers with a valid signature are accepted.
+//
+// Use HeaderCodec.GinMiddleware for custom header names.
+func GinHeaderParserMiddleware(signer *HeaderSigner) gin.HandlerFunc {
+	return defaultHeaderCodec.GinMiddleware(signer)
+}
+
+// GinUnsignedHeaderParserMiddleware is like GinHeaderParserMiddleware but does not verify signatures. See
+// ParseUnsignedHeader for when this is acceptable.
+func GinUnsignedHeaderParserMiddleware(ctx *gin.Context) {
+	defaultHeaderCodec.handleGin(ctx, nil, false)
+}
 
-	SetContextAuthHeader(ctx, header)
+// headerErrorStatus returns the response status for errors of parsing auth headers. A missing signer is a
+// configuration error of the service, not of the request.
+func headerErrorStatus(err error) int {
+	if errors.Is(err, ErrSignerMissing) {
+		return http.StatusInternalServerError
+	}
+	return http.StatusUnauthorized
 }
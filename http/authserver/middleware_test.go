@@ -15,6 +15,7 @@ import (
 func TestMiddlewareGin(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	engine := gin.New()
+	signer := newTestSigner(t, "new")
 
 	t.Run("rejects request without header", func(t *testing.T) {
 		// setup
@@ -22,20 +23,46 @@ func TestMiddlewareGin(t *testing.T) {
 		ctx := gin.CreateTestContextOnly(rec, engine)
 		ctx.Request, _ = http.NewRequest("GET", "/", nil)
 		// invoke middleware
-		GinHeaderParserMiddleware(ctx)
+		GinHeaderParserMiddleware(signer)(ctx)
 		// assert
 		res := rec.Result()
 		require.Equal(t, 401, res.StatusCode)
 	})
 
+	t.Run("fails closed without signer", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		ctx := gin.CreateTestContextOnly(rec, engine)
+		ctx.Request, _ = http.NewRequest("GET", "/", nil)
+		setAuthHeaders(ctx.Request.Header)
+
+		GinHeaderParserMiddleware(nil)(ctx)
+		require.Equal(t, 500, rec.Result().StatusCode)
+		require.Nil(t, GetContextAuthHeader(ctx))
+	})
+
+	t.Run("accepts unsigned headers only if explicitly requested", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		ctx := gin.CreateTestContextOnly(rec, engine)
+		ctx.Request, _ = http.NewRequest("GET", "/", nil)
+		setAuthHeaders(ctx.Request.Header)
+
+		ctx.Request.Header.Set(defaultHeaderPrefix+"Roles", "admin")
+
+		GinUnsignedHeaderParserMiddleware(ctx)
+		require.Equal(t, 200, rec.Result().StatusCode)
+		require.NotNil(t, GetContextAuthHeader(ctx))
+		require.Empty(t, ctx.Request.Header.Get(defaultHeaderPrefix+"Roles"), "flat claim headers must be stripped")
+	})
+
 	t.Run("authenticates proper request", func(t *testing.T) {
 		// setup
 		rec := httptest.NewRecorder()
 		ctx := gin.CreateTestContextOnly(rec, engine)
 		ctx.Request, _ = http.NewRequest("GET", "/", nil)
 		setAuthHeaders(ctx.Request.Header)
+		signer.Sign(ctx.Request.Header, defaultHeaderPrefix, "GET", "/")
 		// invoke middleware
-		GinHeaderParserMiddleware(ctx)
+		GinHeaderParserMiddleware(signer)(ctx)
 
 		// assert
 		res := rec.Result()
@@ -55,6 +82,13 @@ func TestMiddlewareGin(t *testing.T) {
 			require.Equal(t, uuid.MustParse(testTenantId), value.Claims.TenantId)
 		})
 
+		t.Run("jwt can be retrieved via getters", func(t *testing.T) {
+			value := GetContextJwt(ctx)
+			require.NotNil(t, value)
+			require.Equal(t, uuid.MustParse(testTenantId), value.Claims.TenantId)
+			require.Same(t, value, authn.GetCtxJwt(ctx))
+		})
+
 		t.Run("header can be retrieved via must-getter", func(t *testing.T) {
 			value := MustGetContextAuthHeader(ctx)
 			require.NotNil(t, value)
@@ -79,5 +113,7 @@ func setAuthHeaders(header http.Header) {
 		TenantName: tenantName,
 	})
 
-	authHeader.SetOn(header)
+	if err := authHeader.SetOn(header); err != nil {
+		panic(err)
+	}
 }
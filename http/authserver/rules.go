@@ -0,0 +1,116 @@
+package authserver
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/DEXPRO-Solutions-GmbH/go-dauth/http/authn"
+	"github.com/google/uuid"
+)
+
+// AccessRule restricts access to requests matching a path and methods.
+//
+// Rules are evaluated against the original request as passed by the forward-auth proxy (see originalRequest).
+type AccessRule struct {
+	// Path is a glob pattern matched against the request path, e.g. "/admin/**". "*" matches within a single path
+	// segment and "**" matches any number of segments. See path.Match for further syntax.
+	Path string
+	// Methods restricts the rule to the given request methods. Empty matches all methods.
+	Methods []string
+
+	// Public allows requests without a valid token. Valid tokens are still passed to upstream services.
+	Public bool
+
+	// Roles must all be held by the token. See authn.Claims.HasRole for the syntax.
+	Roles []string
+	// Scopes must all be held by the token.
+	Scopes []string
+	// Tenants restricts access to tokens of any of the given tenants. Empty allows all tenants.
+	Tenants []uuid.UUID
+}
+
+// AccessRules is an ordered list of AccessRule. The first matching rule applies.
+type AccessRules []AccessRule
+
+// Match returns the first rule matching the given request method and path or nil if no rule matches.
+func (rules AccessRules) Match(method string, requestPath string) *AccessRule {
+	for i := range rules {
+		if rules[i].matches(method, requestPath) {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+func (rule *AccessRule) matches(method string, requestPath string) bool {
+	if len(rule.Methods) > 0 {
+		found := false
+		for _, m := range rule.Methods {
+			if strings.EqualFold(m, method) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return matchPath(strings.Split(strings.Trim(rule.Path, "/"), "/"), strings.Split(strings.Trim(requestPath, "/"), "/"))
+}
+
+// matchPath matches path segments against pattern segments, supporting "**" for any number of segments.
+func matchPath(pattern []string, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(segments); i++ {
+				if matchPath(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(segments) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], segments[0]); err != nil || !ok {
+			return false
+		}
+
+		pattern, segments = pattern[1:], segments[1:]
+	}
+
+	return len(segments) == 0
+}
+
+// Check returns an error describing the first requirement of the rule not met by the given claims.
+func (rule *AccessRule) Check(claims *authn.Claims) error {
+	for _, role := range rule.Roles {
+		if !claims.HasRole(role) {
+			return fmt.Errorf("missing role '%s'", role)
+		}
+	}
+
+	for _, scope := range rule.Scopes {
+		if !claims.HasScope(scope) {
+			return fmt.Errorf("missing scope '%s'", scope)
+		}
+	}
+
+	if len(rule.Tenants) > 0 {
+		allowed := false
+		for _, tenant := range rule.Tenants {
+			if claims.TenantId == tenant {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("tenant not allowed")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package authserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DEXPRO-Solutions-GmbH/go-dauth/http/authn"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessRules_Match(t *testing.T) {
+	rules := AccessRules{
+		{Path: "/public/**", Public: true},
+		{Path: "/items/*", Methods: []string{"DELETE"}, Roles: []string{"admin"}},
+		{Path: "/items/*/files/*.pdf"},
+	}
+
+	for _, tc := range []struct {
+		method   string
+		path     string
+		expected int
+	}{
+		{"GET", "/public", 0},
+		{"GET", "/public/a/b/c", 0},
+		{"DELETE", "/items/1", 1},
+		{"delete", "/items/1/", 1},
+		{"GET", "/items/1", -1},
+		{"DELETE", "/items/1/2", -1},
+		{"GET", "/items/1/files/a.pdf", 2},
+		{"GET", "/items/1/files/a.png", -1},
+		{"GET", "/other", -1},
+	} {
+		rule := rules.Match(tc.method, tc.path)
+		if tc.expected < 0 {
+			assert.Nil(t, rule, "%s %s", tc.method, tc.path)
+		} else {
+			assert.Same(t, &rules[tc.expected], rule, "%s %s", tc.method, tc.path)
+		}
+	}
+}
+
+func TestAccessRule_Check(t *testing.T) {
+	tenant := uuid.MustParse(testTenantId)
+	claims := &authn.Claims{
+		Scope:       "openid items:write",
+		TenantId:    tenant,
+		RealmAccess: map[string][]string{"roles": {"admin", "user"}},
+	}
+
+	assert.NoError(t, (&AccessRule{}).Check(claims))
+	assert.NoError(t, (&AccessRule{Roles: []string{"admin", "user"}, Scopes: []string{"items:write"}, Tenants: []uuid.UUID{uuid.New(), tenant}}).Check(claims))
+	assert.Error(t, (&AccessRule{Roles: []string{"admin", "owner"}}).Check(claims))
+	assert.Error(t, (&AccessRule{Scopes: []string{"items:delete"}}).Check(claims))
+	assert.Error(t, (&AccessRule{Tenants: []uuid.UUID{uuid.New()}}).Check(claims))
+}
+
+func TestAuthServer_AccessRules(t *testing.T) {
+	claims := newTestClaims()
+	claims.RealmAccess = map[string][]string{"roles": {"user"}}
+	tokenStr := newTestToken(t, claims)
+
+	server := NewAuthServer(newTestStack(), WithAccessRules(
+		AccessRule{Path: "/health", Public: true},
+		AccessRule{Path: "/admin/**", Roles: []string{"admin"}},
+		AccessRule{Path: "/items/**", Methods: []string{"GET"}, Roles: []string{"user"}},
+	))
+
+	newRequest := func(method, uri, token string) *http.Request {
+		request := httptest.NewRequest("GET", "/auth", nil)
+		request.Header.Set("X-Forwarded-Method", method)
+		request.Header.Set("X-Forwarded-Uri", uri)
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+		return request
+	}
+
+	t.Run("public path without token", func(t *testing.T) {
+		rec := serveAuth(server, newRequest("GET", "/health", ""))
+		assert.Equal(t, 204, rec.Code)
+		assert.Empty(t, rec.Header().Get("Dexp-Authserver-Jwt-Plain"))
+	})
+
+	t.Run("public path with token passes headers", func(t *testing.T) {
+		rec := serveAuth(server, newRequest("GET", "/health", tokenStr))
+		assert.Equal(t, 204, rec.Code)
+		assert.NotEmpty(t, rec.Header().Get("Dexp-Authserver-Jwt-Plain"))
+	})
+
+	t.Run("protected path without token", func(t *testing.T) {
+		rec := serveAuth(server, newRequest("GET", "/admin/users", ""))
+		assert.Equal(t, 401, rec.Code)
+	})
+
+	t.Run("protected path with insufficient token", func(t *testing.T) {
+		rec := serveAuth(server, newRequest("GET", "/admin/users", tokenStr))
+		assert.Equal(t, 403, rec.Code)
+	})
+
+	t.Run("protected path with sufficient token", func(t *testing.T) {
+		rec := serveAuth(server, newRequest("GET", "/items/1?expand=true", tokenStr))
+		require.Equal(t, 204, rec.Code)
+	})
+
+	t.Run("unmatched path only requires a valid token", func(t *testing.T) {
+		rec := serveAuth(server, newRequest("POST", "/items/1", tokenStr))
+		require.Equal(t, 204, rec.Code)
+	})
+
+	t.Run("original uri header", func(t *testing.T) {
+		request := httptest.NewRequest("GET", "/auth", nil)
+		request.Header.Set("X-Original-Uri", "/admin/users")
+		request.Header.Set("Authorization", "Bearer "+tokenStr)
+
+		rec := serveAuth(server, request)
+		assert.Equal(t, 403, rec.Code)
+	})
+}
@@ -0,0 +1,145 @@
+package authserver
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	headerSignature = "Signature"
+
+	// defaultSignatureMaxAge is the default duration for which signed headers are accepted.
+	defaultSignatureMaxAge = 30 * time.Second
+)
+
+var (
+	ErrSignatureMissing = errors.New("missing header signature")
+	ErrSignatureInvalid = errors.New("invalid header signature")
+	ErrSignatureStale   = errors.New("stale header signature")
+
+	// ErrSignerMissing is returned when parsing signed headers without a HeaderSigner.
+	ErrSignerMissing = errors.New("no header signer configured")
+)
+
+// KeyRing holds the HMAC keys used to sign and verify headers, mapped by their key id.
+//
+// Headers are always signed with the signing key but verified with any key of the ring. This allows to rotate keys
+// without downtime: First distribute the new key to all verifying services, then switch the signing key.
+type KeyRing struct {
+	signingKeyId string
+	keys         map[string][]byte
+}
+
+// NewKeyRing creates a KeyRing. The signing key id must be contained in keys.
+func NewKeyRing(signingKeyId string, keys map[string][]byte) (*KeyRing, error) {
+	if _, ok := keys[signingKeyId]; !ok {
+		return nil, fmt.Errorf("signing key '%s' not found in key ring", signingKeyId)
+	}
+	for id := range keys {
+		if id == "" || strings.ContainsAny(id, ",= ") {
+			return nil, fmt.Errorf("invalid key id '%s'", id)
+		}
+	}
+	return &KeyRing{signingKeyId: signingKeyId, keys: keys}, nil
+}
+
+// HeaderSigner signs and verifies the headers set by an AuthServer.
+//
+// Signatures cover all headers of the AuthServer, a timestamp and the method and path of the authenticated request.
+// This prevents clients from sending arbitrary claims to services which are reachable without passing the auth proxy
+// and from replaying signed headers for other requests.
+//
+// Note that the request binding requires proxies to not rewrite the method or path of requests between the
+// AuthServer and the receiving service.
+type HeaderSigner struct {
+	keys   *KeyRing
+	maxAge time.Duration
+	now    func() time.Time
+}
+
+// NewHeaderSigner creates a HeaderSigner. Signed headers are accepted for maxAge after signing. If maxAge is zero,
+// a default of 30 seconds is used.
+func NewHeaderSigner(keys *KeyRing, maxAge time.Duration) *HeaderSigner {
+	if maxAge == 0 {
+		maxAge = defaultSignatureMaxAge
+	}
+	return &HeaderSigner{keys: keys, maxAge: maxAge, now: time.Now}
+}
+
+// Sign adds a signature over all headers with the given prefix to header.
+func (s *HeaderSigner) Sign(header http.Header, prefix string, method string, path string) {
+	ts := strconv.FormatInt(s.now().Unix(), 10)
+	kid := s.keys.signingKeyId
+
+	sig := s.compute(s.keys.keys[kid], header, prefix, ts, method, path)
+	header.Set(prefix+headerSignature, fmt.Sprintf("kid=%s,ts=%s,sig=%s", kid, ts, sig))
+}
+
+// Verify checks the signature over all headers with the given prefix.
+func (s *HeaderSigner) Verify(header http.Header, prefix string, method string, path string) error {
+	values := header.Values(prefix + headerSignature)
+	if len(values) == 0 {
+		return ErrSignatureMissing
+	}
+	if len(values) > 1 {
+		return ErrSignatureInvalid
+	}
+
+	params := map[string]string{}
+	for _, part := range strings.Split(values[0], ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		params[key] = value
+	}
+
+	key, ok := s.keys.keys[params["kid"]]
+	if !ok {
+		return ErrSignatureInvalid
+	}
+
+	ts, err := strconv.ParseInt(params["ts"], 10, 64)
+	if err != nil {
+		return ErrSignatureInvalid
+	}
+
+	expected := s.compute(key, header, prefix, params["ts"], method, path)
+	if !hmac.Equal([]byte(expected), []byte(params["sig"])) {
+		return ErrSignatureInvalid
+	}
+
+	age := s.now().Sub(time.Unix(ts, 0))
+	if age > s.maxAge || age < -s.maxAge {
+		return ErrSignatureStale
+	}
+
+	return nil
+}
+
+// compute returns the base64url encoded HMAC over the canonical representation of the signed data.
+func (s *HeaderSigner) compute(key []byte, header http.Header, prefix string, ts string, method string, path string) string {
+	canonicalPrefix := http.CanonicalHeaderKey(prefix)
+	signatureName := http.CanonicalHeaderKey(prefix + headerSignature)
+
+	var names []string
+	for name := range header {
+		if strings.HasPrefix(name, canonicalPrefix) && name != signatureName {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	mac := hmac.New(sha256.New, key)
+	_, _ = fmt.Fprintf(mac, "%s\n%s\n%s\n", ts, strings.ToUpper(method), path)
+	for _, name := range names {
+		_, _ = fmt.Fprintf(mac, "%s:%s\n", strings.ToLower(name), strings.Join(header.Values(name), ","))
+	}
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
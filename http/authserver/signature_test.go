@@ -0,0 +1,195 @@
+package authserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSigner(t *testing.T, signingKeyId string) *HeaderSigner {
+	keys, err := NewKeyRing(signingKeyId, map[string][]byte{
+		"old": []byte("old-secret"),
+		"new": []byte("new-secret"),
+	})
+	require.NoError(t, err)
+	return NewHeaderSigner(keys, time.Minute)
+}
+
+func TestHeaderSigner(t *testing.T) {
+	signer := newTestSigner(t, "new")
+
+	newSignedHeader := func() http.Header {
+		header := http.Header{}
+		setAuthHeaders(header)
+		signer.Sign(header, defaultHeaderPrefix, "GET", "/items")
+		return header
+	}
+
+	t.Run("accepts valid signature", func(t *testing.T) {
+		assert.NoError(t, signer.Verify(newSignedHeader(), defaultHeaderPrefix, "GET", "/items"))
+	})
+
+	t.Run("accepts signature of other key in ring", func(t *testing.T) {
+		header := http.Header{}
+		setAuthHeaders(header)
+		newTestSigner(t, "old").Sign(header, defaultHeaderPrefix, "GET", "/items")
+
+		assert.NoError(t, signer.Verify(header, defaultHeaderPrefix, "GET", "/items"))
+	})
+
+	t.Run("rejects unsigned header", func(t *testing.T) {
+		header := http.Header{}
+		setAuthHeaders(header)
+
+		assert.ErrorIs(t, signer.Verify(header, defaultHeaderPrefix, "GET", "/items"), ErrSignatureMissing)
+	})
+
+	t.Run("rejects tampered claims", func(t *testing.T) {
+		header := newSignedHeader()
+		header.Set(defaultHeaderPrefix+headerJwtPlain, `{"tenant_name":"evil"}`)
+
+		assert.ErrorIs(t, signer.Verify(header, defaultHeaderPrefix, "GET", "/items"), ErrSignatureInvalid)
+	})
+
+	t.Run("rejects added header", func(t *testing.T) {
+		header := newSignedHeader()
+		header.Set(defaultHeaderPrefix+headerRealm, "evil")
+
+		assert.ErrorIs(t, signer.Verify(header, defaultHeaderPrefix, "GET", "/items"), ErrSignatureInvalid)
+	})
+
+	t.Run("rejects other request", func(t *testing.T) {
+		assert.ErrorIs(t, signer.Verify(newSignedHeader(), defaultHeaderPrefix, "DELETE", "/items"), ErrSignatureInvalid)
+		assert.ErrorIs(t, signer.Verify(newSignedHeader(), defaultHeaderPrefix, "GET", "/other"), ErrSignatureInvalid)
+	})
+
+	t.Run("rejects unknown key", func(t *testing.T) {
+		keys, err := NewKeyRing("other", map[string][]byte{"other": []byte("other-secret")})
+		require.NoError(t, err)
+
+		assert.ErrorIs(t, NewHeaderSigner(keys, 0).Verify(newSignedHeader(), defaultHeaderPrefix, "GET", "/items"), ErrSignatureInvalid)
+	})
+
+	t.Run("rejects stale signature", func(t *testing.T) {
+		header := newSignedHeader()
+
+		stale := newTestSigner(t, "new")
+		stale.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+
+		assert.ErrorIs(t, stale.Verify(header, defaultHeaderPrefix, "GET", "/items"), ErrSignatureStale)
+	})
+}
+
+func TestNewKeyRing(t *testing.T) {
+	_, err := NewKeyRing("missing", map[string][]byte{"key": []byte("secret")})
+	assert.Error(t, err)
+}
+
+func TestSignedMiddlewareGin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	signer := newTestSigner(t, "new")
+	mw := GinHeaderParserMiddleware(signer)
+
+	t.Run("rejects unsigned request", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		ctx := gin.CreateTestContextOnly(rec, engine)
+		ctx.Request = httptest.NewRequest("GET", "/items", nil)
+		setAuthHeaders(ctx.Request.Header)
+
+		mw(ctx)
+		require.Equal(t, 401, rec.Result().StatusCode)
+	})
+
+	t.Run("authenticates signed request", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		ctx := gin.CreateTestContextOnly(rec, engine)
+		ctx.Request = httptest.NewRequest("GET", "/items?page=2", nil)
+		setAuthHeaders(ctx.Request.Header)
+		signer.Sign(ctx.Request.Header, defaultHeaderPrefix, "GET", "/items")
+
+		mw(ctx)
+		require.Equal(t, 200, rec.Result().StatusCode)
+		require.NotNil(t, GetContextAuthHeader(ctx))
+	})
+}
+
+func TestOriginalRequest(t *testing.T) {
+	t.Run("uses forwarded headers", func(t *testing.T) {
+		request := httptest.NewRequest("GET", "/auth", nil)
+		request.Header.Set("X-Forwarded-Method", "POST")
+		request.Header.Set("X-Forwarded-Uri", "/items/1?expand=true")
+
+		method, path, err := originalRequest(request)
+		require.NoError(t, err)
+		assert.Equal(t, "POST", method)
+		assert.Equal(t, "/items/1", path)
+	})
+
+	t.Run("falls back to request", func(t *testing.T) {
+		request := httptest.NewRequest("PUT", "/items/2", nil)
+
+		method, path, err := originalRequest(request)
+		require.NoError(t, err)
+		assert.Equal(t, "PUT", method)
+		assert.Equal(t, "/items/2", path)
+	})
+
+	tests := []struct {
+		uri  string
+		path string
+		err  bool
+	}{
+		{uri: "/public/x", path: "/public/x"},
+		{uri: "/public/x/", path: "/public/x/"},
+		{uri: "/public/M%C3%BCller", path: "/public/Müller"},
+		{uri: "/public/../admin/x", err: true},
+		{uri: "/public/..%2Fadmin/x", err: true},
+		{uri: "/public/..%2fadmin/x", err: true},
+		{uri: "/public/%2E%2E/admin/x", err: true},
+		{uri: "/public/a%2Fb", err: true},
+		{uri: "/public/..%5Cadmin", err: true},
+		{uri: "/public/..\\admin", err: true},
+		{uri: "/public/./x", err: true},
+		{uri: "/public/x/.", err: true},
+		{uri: "/public//x", err: true},
+		{uri: "//admin", err: true},
+		{uri: "/public/x//", err: true},
+		{uri: "admin", err: true},
+		{uri: "/public/%zz", err: true},
+	}
+	for _, test := range tests {
+		t.Run("validates "+test.uri, func(t *testing.T) {
+			request := httptest.NewRequest("GET", "/auth", nil)
+			request.Header.Set("X-Forwarded-Uri", test.uri)
+
+			_, path, err := originalRequest(request)
+			if test.err {
+				assert.ErrorIs(t, err, ErrInvalidPath)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.path, path)
+		})
+	}
+
+	t.Run("does not fall back to request for invalid forwarded uri", func(t *testing.T) {
+		request := httptest.NewRequest("GET", "/public/x", nil)
+		request.Header.Set("X-Original-Uri", "/public/../admin")
+
+		_, _, err := originalRequest(request)
+		assert.ErrorIs(t, err, ErrInvalidPath)
+	})
+
+	t.Run("validates request path", func(t *testing.T) {
+		request := httptest.NewRequest("GET", "/public/..%2Fadmin", nil)
+
+		_, _, err := originalRequest(request)
+		assert.ErrorIs(t, err, ErrInvalidPath)
+	})
+}